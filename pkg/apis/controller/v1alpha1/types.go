@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 contains the GitLab controller API types.
+package v1alpha1
+
+import (
+	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BucketSpec defines a single object storage bucket that the GitLab Helm
+// release should be wired up to use, e.g. for backups or LFS/artifact
+// storage.
+type BucketSpec struct {
+	Name string `json:"name"`
+	// BackupStaleAfter is the maximum amount of time that may pass without a
+	// new object appearing under this bucket's backups/ prefix before its
+	// BackupHealthy condition is marked false. A bucket with no objects under
+	// that prefix is not marked stale. Leave nil to disable staleness
+	// checking.
+	BackupStaleAfter *metav1.Duration `json:"backupStaleAfter,omitempty"`
+	// ProbeInterval is the minimum amount of time that must pass between
+	// artifact probes of this bucket. Leave nil to probe on every reconcile.
+	ProbeInterval *metav1.Duration `json:"probeInterval,omitempty"`
+	// Retention configures auto-pruning of old objects under this bucket's
+	// backups/ prefix, and what happens to its Bucket claim when this
+	// bucket is removed. Leave nil to disable pruning and always delete the
+	// claim.
+	Retention *RetentionPolicy `json:"retention,omitempty"`
+}
+
+// BucketDeletePolicy controls what happens to a bucket's Crossplane Bucket
+// claim when the GitLab resource that provisioned it is deleted.
+type BucketDeletePolicy string
+
+const (
+	// BucketDeletePolicyDelete lets the Bucket claim be garbage collected
+	// along with the GitLab resource that owns it. This is the default.
+	BucketDeletePolicyDelete BucketDeletePolicy = "Delete"
+	// BucketDeletePolicyRetain strips the Bucket claim's owner reference on
+	// deletion of the GitLab resource, leaving the claim (and the storage it
+	// provisioned) behind.
+	BucketDeletePolicyRetain BucketDeletePolicy = "Retain"
+)
+
+// RetentionPolicy configures auto-pruning of old backup objects for a
+// bucket, and what happens to its Bucket claim on deletion.
+type RetentionPolicy struct {
+	// KeepLastN retains only the N most recently modified objects under the
+	// bucket's backups/ prefix, pruning the rest. Zero disables count-based
+	// pruning.
+	KeepLastN int `json:"keepLastN,omitempty"`
+	// MaxAge prunes objects under the bucket's backups/ prefix older than
+	// this duration. Leave nil to disable age-based pruning.
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// DeletePolicy controls what happens to this bucket's Bucket claim when
+	// the GitLab resource that owns it is deleted. Defaults to Delete.
+	DeletePolicy BucketDeletePolicy `json:"deletePolicy,omitempty"`
+}
+
+// BucketStatus records what the artifact probe last observed about a
+// provisioned bucket.
+type BucketStatus struct {
+	xpcorev1alpha1.ConditionedStatus `json:",inline"`
+
+	LastRevision     string      `json:"lastRevision,omitempty"`
+	LastObservedTime metav1.Time `json:"lastObservedTime,omitempty"`
+	ObjectCount      int         `json:"objectCount,omitempty"`
+	// PrunedCount is the number of objects the bucket pruner deleted the
+	// last time it ran.
+	PrunedCount int `json:"prunedCount,omitempty"`
+}
+
+// CredentialsBackend configures where bucket connection credentials are
+// sourced from. When Type is empty the in-cluster Secret a Crossplane
+// resource claim's status.credentialsSecretRef points to is used, matching
+// prior behavior.
+type CredentialsBackend struct {
+	// Type selects the credentialSource implementation, e.g. "Vault" or
+	// "AzureKeyVault". Leave empty to use the in-cluster Secret backend.
+	Type string `json:"type,omitempty"`
+	// Address is the backend's API address, e.g. a Vault server URL or an
+	// Azure Key Vault URI.
+	Address string `json:"address,omitempty"`
+	// AuthRef references the credentials used to authenticate to the
+	// backend itself (e.g. a Kubernetes Secret holding a Vault token).
+	AuthRef corev1.ObjectReference `json:"authRef,omitempty"`
+}
+
+// GitLabSpec defines the desired state of a GitLab release.
+type GitLabSpec struct {
+	ProviderRef        corev1.ObjectReference `json:"providerRef"`
+	Buckets            []BucketSpec           `json:"buckets,omitempty"`
+	CredentialsBackend CredentialsBackend     `json:"credentialsBackend,omitempty"`
+}
+
+// GitLabStatus defines the observed state of a GitLab release.
+type GitLabStatus struct {
+	// Buckets records the artifact probe's last observation of each
+	// provisioned bucket, keyed by bucket name.
+	Buckets map[string]BucketStatus `json:"buckets,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GitLab is the Schema for the gitlabs API.
+type GitLab struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GitLabSpec   `json:"spec,omitempty"`
+	Status GitLabStatus `json:"status,omitempty"`
+}
+
+// GetProviderRef returns a reference to the Crossplane Provider this GitLab
+// resource's claims should be satisfied from.
+func (g *GitLab) GetProviderRef() corev1.ObjectReference {
+	return g.Spec.ProviderRef
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// GitLabList contains a list of GitLab.
+type GitLabList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GitLab `json:"items"`
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Connection secret key an azureConfig is read from, alongside the
+// storage account keys an azureBlobSecretUpdater already expects to find
+// there.
+const keyAzureContainerName = "AZURE_STORAGE_CONTAINER_NAME"
+
+// azureStorageAPIVersion is the x-ms-version this controller signs its
+// Azure Blob Storage requests against.
+const azureStorageAPIVersion = "2019-02-02"
+
+// azureConfig is the credentials and location an azureBucketLister or
+// azureBucketDeleter needs to talk to a bucket's Azure Blob Storage API.
+type azureConfig struct {
+	AccountName string
+	AccountKey  []byte
+	Container   string
+	// Endpoint overrides the default Azure Blob Storage endpoint. Used by
+	// tests.
+	Endpoint string
+}
+
+// azureConfigFromSecret reads an azureConfig out of a Bucket claim's
+// connection secret.
+func azureConfigFromSecret(secret *corev1.Secret) (*azureConfig, error) {
+	account, ok := secret.Data[keyAzureStorageAccount]
+	if !ok {
+		return nil, errors.Errorf(errorFmtMissingSecretKey, keyAzureStorageAccount)
+	}
+	key, ok := secret.Data[keyAzureStorageKey]
+	if !ok {
+		return nil, errors.Errorf(errorFmtMissingSecretKey, keyAzureStorageKey)
+	}
+	container, ok := secret.Data[keyAzureContainerName]
+	if !ok {
+		return nil, errors.Errorf(errorFmtMissingSecretKey, keyAzureContainerName)
+	}
+
+	decodedKey, err := base64.StdEncoding.DecodeString(string(key))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode azure storage account key")
+	}
+
+	return &azureConfig{AccountName: string(account), AccountKey: decodedKey, Container: string(container)}, nil
+}
+
+// endpoint returns the Azure Blob Storage endpoint this config talks to,
+// defaulting to the account's real-world endpoint when Endpoint is not set.
+func (cfg *azureConfig) endpoint() string {
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	return fmt.Sprintf("https://%s.blob.core.windows.net", cfg.AccountName)
+}
+
+// azureBlob is a single <Blob> entry in an Azure list blobs response.
+type azureBlob struct {
+	Name       string `xml:"Name"`
+	Properties struct {
+		ETag          string `xml:"Etag"`
+		ContentLength int64  `xml:"Content-Length"`
+		LastModified  string `xml:"Last-Modified"`
+	} `xml:"Properties"`
+}
+
+// azureListBlobsResult is an Azure list blobs response.
+type azureListBlobsResult struct {
+	XMLName    xml.Name    `xml:"EnumerationResults"`
+	Blobs      []azureBlob `xml:"Blobs>Blob"`
+	NextMarker string      `xml:"NextMarker"`
+}
+
+// azureListObjects lists every blob under prefix in cfg's container,
+// following markers until the listing is exhausted.
+func azureListObjects(ctx context.Context, cfg *azureConfig, prefix string) ([]bucketObject, error) {
+	var objects []bucketObject
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+
+		req, err := newAzureRequest(ctx, http.MethodGet, cfg, query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := doAzureRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &azureListBlobsResult{}
+		if err := xml.Unmarshal(body, result); err != nil {
+			return nil, err
+		}
+
+		for _, b := range result.Blobs {
+			lastModified, err := time.Parse(time.RFC1123, b.Properties.LastModified)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse last modified time of blob %q", b.Name)
+			}
+			objects = append(objects, bucketObject{
+				Key:          b.Name,
+				ETag:         strings.Trim(b.Properties.ETag, `"`),
+				Size:         b.Properties.ContentLength,
+				LastModified: lastModified,
+			})
+		}
+
+		if result.NextMarker == "" {
+			return objects, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// azureDeleteObjects deletes the blobs with the given keys from cfg's
+// container, issuing one Delete Blob call per key since Azure's blob
+// deletion API is not batched.
+func azureDeleteObjects(ctx context.Context, cfg *azureConfig, keys []string) error {
+	for _, key := range keys {
+		req, err := newAzureRequest(ctx, http.MethodDelete, cfg, url.Values{}, strings.Split(key, "/"))
+		if err != nil {
+			return err
+		}
+		if _, err := doAzureRequest(req); err != nil {
+			return errors.Wrapf(err, "failed to delete blob %q", key)
+		}
+	}
+	return nil
+}
+
+// newAzureRequest builds a SharedKeyLite-signed request against cfg's
+// container, with the given query parameters and, for blob-scoped
+// requests, path appended after the container name.
+func newAzureRequest(ctx context.Context, method string, cfg *azureConfig, query url.Values, path []string) (*http.Request, error) {
+	u, err := url.Parse(cfg.endpoint())
+	if err != nil {
+		return nil, err
+	}
+	segments := append([]string{cfg.Container}, path...)
+	u.Path = "/" + strings.Join(segments, "/")
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureStorageAPIVersion)
+	signAzureRequest(req, cfg)
+	return req, nil
+}
+
+// signAzureRequest signs req for cfg's account using Shared Key Lite,
+// setting its Authorization header.
+func signAzureRequest(req *http.Request, cfg *azureConfig) {
+	canonicalizedHeaders := canonicalAzureHeaders(req)
+	canonicalizedResource := canonicalAzureResource(cfg.AccountName, req.URL)
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date: omitted in favor of the signed x-ms-date header.
+		canonicalizedHeaders + canonicalizedResource,
+	}, "\n")
+
+	h := hmac.New(sha256.New, cfg.AccountKey)
+	h.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKeyLite %s:%s", cfg.AccountName, signature))
+}
+
+// canonicalAzureHeaders returns the canonicalized x-ms-* headers block of
+// req, sorted by header name, for a Shared Key Lite string-to-sign.
+func canonicalAzureHeaders(req *http.Request) string {
+	var names []string
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s:%s\n", name, req.Header.Get(name))
+	}
+	return b.String()
+}
+
+// canonicalAzureResource returns the canonicalized resource string of u,
+// for a Shared Key Lite string-to-sign.
+func canonicalAzureResource(account string, u *url.URL) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "/%s%s", account, u.Path)
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		fmt.Fprintf(&b, "\n%s:%s", strings.ToLower(name), strings.Join(values, ","))
+	}
+	return b.String()
+}
+
+// doAzureRequest executes req and returns its response body, erroring out
+// if the request itself fails or Azure responds with a non-2xx status.
+func doAzureRequest(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.Errorf("azure request failed with status %s: %s", resp.Status, body)
+	}
+	return body, nil
+}
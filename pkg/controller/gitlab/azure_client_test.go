@@ -0,0 +1,180 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_azureConfigFromSecret(t *testing.T) {
+	cases := map[string]struct {
+		secret  *corev1.Secret
+		want    *azureConfig
+		wantErr error
+	}{
+		"MissingAccountName": {
+			secret:  &corev1.Secret{Data: map[string][]byte{}},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyAzureStorageAccount),
+		},
+		"MissingContainerName": {
+			secret: &corev1.Secret{Data: map[string][]byte{
+				keyAzureStorageAccount: []byte("account"),
+				keyAzureStorageKey:     []byte("dGVzdC1rZXk="),
+			}},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyAzureContainerName),
+		},
+		"Successful": {
+			secret: &corev1.Secret{Data: map[string][]byte{
+				keyAzureStorageAccount: []byte("account"),
+				keyAzureStorageKey:     []byte("dGVzdC1rZXk="),
+				keyAzureContainerName:  []byte("test-container"),
+			}},
+			want: &azureConfig{AccountName: "account", AccountKey: []byte("test-key"), Container: "test-container"},
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := azureConfigFromSecret(tt.secret)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("azureConfigFromSecret() error %s", diff)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("azureConfigFromSecret() -got, +want: %s", diff)
+			}
+		})
+	}
+}
+
+func Test_azureListObjects(t *testing.T) {
+	ctx := context.TODO()
+	oldest := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	newest := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKeyLite test-account:") {
+			http.Error(w, "missing or malformed Authorization header", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("prefix") != bucketBackupsPrefix {
+			http.Error(w, "missing expected prefix", http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Query().Get("marker") == "" {
+			w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<EnumerationResults>
+  <Blobs>
+    <Blob>
+      <Name>backups/old</Name>
+      <Properties>
+        <Last-Modified>` + oldest.Format(time.RFC1123) + `</Last-Modified>
+        <Etag>"a"</Etag>
+        <Content-Length>1</Content-Length>
+      </Properties>
+    </Blob>
+  </Blobs>
+  <NextMarker>page-2</NextMarker>
+</EnumerationResults>`))
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<EnumerationResults>
+  <Blobs>
+    <Blob>
+      <Name>backups/new</Name>
+      <Properties>
+        <Last-Modified>` + newest.Format(time.RFC1123) + `</Last-Modified>
+        <Etag>"b"</Etag>
+        <Content-Length>2</Content-Length>
+      </Properties>
+    </Blob>
+  </Blobs>
+</EnumerationResults>`))
+	}))
+	defer srv.Close()
+
+	cfg := &azureConfig{AccountName: "test-account", AccountKey: []byte("test-key"), Container: "test-container", Endpoint: srv.URL}
+
+	got, err := azureListObjects(ctx, cfg, bucketBackupsPrefix)
+	if err != nil {
+		t.Fatalf("azureListObjects() error = %s", err)
+	}
+	want := []bucketObject{
+		{Key: "backups/old", ETag: "a", Size: 1, LastModified: oldest},
+		{Key: "backups/new", ETag: "b", Size: 2, LastModified: newest},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("azureListObjects() -got, +want: %s", diff)
+	}
+	if requests != 2 {
+		t.Errorf("azureListObjects() made %d requests, want 2 (one per page)", requests)
+	}
+}
+
+func Test_azureDeleteObjects(t *testing.T) {
+	ctx := context.TODO()
+
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "expected DELETE", http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKeyLite test-account:") {
+			http.Error(w, "missing or malformed Authorization header", http.StatusBadRequest)
+			return
+		}
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/test-container/"))
+	}))
+	defer srv.Close()
+
+	cfg := &azureConfig{AccountName: "test-account", AccountKey: []byte("test-key"), Container: "test-container", Endpoint: srv.URL}
+
+	if err := azureDeleteObjects(ctx, cfg, []string{"backups/old", "backups/older"}); err != nil {
+		t.Fatalf("azureDeleteObjects() error = %s", err)
+	}
+	want := []string{"backups/old", "backups/older"}
+	if diff := cmp.Diff(deleted, want); diff != "" {
+		t.Errorf("azureDeleteObjects() -got, +want: %s", diff)
+	}
+}
+
+func Test_canonicalAzureResource(t *testing.T) {
+	cfg := &azureConfig{AccountName: "test-account", Container: "test-container"}
+	req, err := newAzureRequest(context.TODO(), http.MethodGet, cfg, url.Values{"comp": {"list"}, "restype": {"container"}}, nil)
+	if err != nil {
+		t.Fatalf("newAzureRequest() error = %s", err)
+	}
+
+	got := canonicalAzureResource(cfg.AccountName, req.URL)
+	want := "/test-account/test-container\ncomp:list\nrestype:container"
+	if got != want {
+		t.Errorf("canonicalAzureResource() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// bucketBackupsPrefix is the object key prefix the artifact probe lists to
+// determine whether GitLab is actively writing backups into a bucket.
+const bucketBackupsPrefix = "backups/"
+
+// conditionBackupHealthy is set false on a GitLab resource's bucket status
+// once the artifact probe has gone longer than the bucket's
+// backupStaleAfter without observing a new object.
+const conditionBackupHealthy xpcorev1alpha1.ConditionType = "BackupHealthy"
+
+const errorFailedToListBucketObjects = "failed to list bucket objects"
+
+// conditionTrue returns a Condition of the given type in status True.
+func conditionTrue(t xpcorev1alpha1.ConditionType) xpcorev1alpha1.Condition {
+	return xpcorev1alpha1.Condition{
+		Type:               t,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+	}
+}
+
+// conditionFalse returns a Condition of the given type in status False,
+// carrying reason as its message.
+func conditionFalse(t xpcorev1alpha1.ConditionType, reason string) xpcorev1alpha1.Condition {
+	return xpcorev1alpha1.Condition{
+		Type:               t,
+		Status:             corev1.ConditionFalse,
+		Message:            reason,
+		LastTransitionTime: metav1.Now(),
+	}
+}
+
+// bucketObject describes a single object the artifact probe observed while
+// listing a bucket.
+type bucketObject struct {
+	Key          string
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// A bucketLister lists the objects under a prefix in a bucket, using the
+// bucket's connection secret to authenticate. Each supported provider gets
+// its own implementation, dispatched the same way secretUpdater is.
+type bucketLister interface {
+	list(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error)
+}
+
+// defaultBucketListers returns the bucketLister registered for every
+// provider this controller knows how to list objects for.
+func defaultBucketListers() map[string]bucketLister {
+	return map[string]bucketLister{
+		providerS3:    &s3BucketLister{},
+		providerGCS:   &gcsBucketLister{},
+		providerAzure: &azureBucketLister{},
+	}
+}
+
+type s3BucketLister struct{}
+
+func (l *s3BucketLister) list(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+	cfg, err := s3ConfigFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	return s3ListObjects(ctx, cfg, prefix)
+}
+
+type gcsBucketLister struct{}
+
+func (l *gcsBucketLister) list(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+	cfg, err := gcsConfigFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	return gcsListObjects(ctx, cfg, prefix)
+}
+
+type azureBucketLister struct{}
+
+func (l *azureBucketLister) list(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+	cfg, err := azureConfigFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	return azureListObjects(ctx, cfg, prefix)
+}
+
+// probeResult is what a bucketArtifactProbe observed about a bucket.
+type probeResult struct {
+	Revision         string
+	ObjectCount      int
+	NewestObjectTime time.Time
+}
+
+// A bucketArtifactProbe lists a bucket using its just-materialized
+// credentials and reports back a revision computed from its newest object.
+type bucketArtifactProbe interface {
+	probe(ctx context.Context) (*probeResult, error)
+}
+
+// defaultBucketArtifactProbe is the default bucketArtifactProbe. It fetches
+// the bucket's connection secret via a credentialSource and lists the bucket
+// using the provider-appropriate bucketLister.
+type defaultBucketArtifactProbe struct {
+	*baseResourceReconciler
+
+	credentialSource credentialSource
+	prefix           string
+	listers          map[string]bucketLister
+}
+
+// newBucketArtifactProbe returns a bucketArtifactProbe for the named
+// bucket of the supplied base reconciler, backed by the default, built-in
+// bucketListers.
+func newBucketArtifactProbe(base *baseResourceReconciler, source credentialSource) *defaultBucketArtifactProbe {
+	return &defaultBucketArtifactProbe{
+		baseResourceReconciler: base,
+		credentialSource:       source,
+		prefix:                 bucketBackupsPrefix,
+		listers:                defaultBucketListers(),
+	}
+}
+
+// provider returns the key under which this probe looks up its
+// bucketLister, derived from the GitLab resource's provider reference.
+func (p *defaultBucketArtifactProbe) provider() string {
+	return providerKeyFromRef(p.GitLab.GetProviderRef())
+}
+
+func (p *defaultBucketArtifactProbe) probe(ctx context.Context) (*probeResult, error) {
+	if p.status == nil {
+		return nil, errors.New(errorResourceStatusIsNotFound)
+	}
+
+	secretKey := types.NamespacedName{Namespace: p.GitLab.GetNamespace(), Name: p.status.CredentialsSecretRef.Name}
+
+	source := p.credentialSource
+	if source == nil {
+		source = &secretCredentialSource{client: p.client}
+	}
+	secret, err := source.Fetch(ctx, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, ok := p.listers[p.provider()]
+	if !ok {
+		return nil, errors.Errorf(errorFmtNotSupportedProvider, p.provider())
+	}
+
+	objects, err := lister.list(ctx, secret, p.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, errorFailedToListBucketObjects)
+	}
+
+	if len(objects) == 0 {
+		return &probeResult{}, nil
+	}
+
+	newest := objects[0]
+	for _, o := range objects[1:] {
+		if o.LastModified.After(newest.LastModified) {
+			newest = o
+		}
+	}
+
+	return &probeResult{
+		Revision:         fmt.Sprintf("%s-%s-%s", newest.Key, newest.ETag, newest.LastModified.UTC().Format(time.RFC3339)),
+		ObjectCount:      len(objects),
+		NewestObjectTime: newest.LastModified,
+	}, nil
+}
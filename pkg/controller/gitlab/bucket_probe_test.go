@@ -0,0 +1,200 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplaneio/gitlab-controller/pkg/test"
+)
+
+type mockBucketLister struct {
+	mockList func(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error)
+}
+
+func (m *mockBucketLister) list(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+	return m.mockList(ctx, secret, prefix)
+}
+
+func Test_defaultBucketArtifactProbe_probe(t *testing.T) {
+	ctx := context.TODO()
+	testError := errors.New("test-error")
+	testSecret := "test-secret"
+	testSecretKey := types.NamespacedName{Namespace: testNamespace, Name: testSecret}
+	oldest := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	newest := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	type fields struct {
+		baseResourceReconciler *baseResourceReconciler
+		listers                map[string]bucketLister
+	}
+	tests := map[string]struct {
+		fields  fields
+		want    *probeResult
+		wantErr error
+	}{
+		"NoStatus": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().build(),
+				},
+			},
+			wantErr: errors.New(errorResourceStatusIsNotFound),
+		},
+		"FailedToRetrieveSecret": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+							return testError
+						},
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+			},
+			wantErr: errors.Wrapf(testError, errorFmtFailedToRetrieveConnectionSecret, testSecretKey),
+		},
+		"NotSupportedProvider": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+			},
+			wantErr: errors.Errorf(errorFmtNotSupportedProvider, providerS3),
+		},
+		"ListFailed": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+				listers: map[string]bucketLister{
+					providerS3: &mockBucketLister{
+						mockList: func(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+							return nil, testError
+						},
+					},
+				},
+			},
+			wantErr: errors.Wrap(testError, errorFailedToListBucketObjects),
+		},
+		"NoObjects": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+				listers: map[string]bucketLister{
+					providerS3: &mockBucketLister{
+						mockList: func(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+							return nil, nil
+						},
+					},
+				},
+			},
+			want: &probeResult{},
+		},
+		"Successful": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+				listers: map[string]bucketLister{
+					providerS3: &mockBucketLister{
+						mockList: func(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+							return []bucketObject{
+								{Key: "backups/old", ETag: "a", LastModified: oldest},
+								{Key: "backups/new", ETag: "b", LastModified: newest},
+							}, nil
+						},
+					},
+				},
+			},
+			want: &probeResult{
+				Revision:         "backups/new-b-" + newest.Format(time.RFC3339),
+				ObjectCount:      2,
+				NewestObjectTime: newest,
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &defaultBucketArtifactProbe{
+				baseResourceReconciler: tt.fields.baseResourceReconciler,
+				listers:                tt.fields.listers,
+			}
+			got, err := p.probe(ctx)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("defaultBucketArtifactProbe.probe() error %s", diff)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("defaultBucketArtifactProbe.probe() -got, +want: %s", diff)
+			}
+		})
+	}
+}
+
+// Test_newBucketArtifactProbe_probe_UnrecognizedProvider constructs a probe
+// via the real newBucketArtifactProbe constructor, wired up with the real,
+// built-in bucketListers, to confirm that a GitLab resource whose
+// ProviderRef.Kind isn't one this controller recognizes actually surfaces
+// errorFmtNotSupportedProvider rather than being silently treated as S3.
+func Test_newBucketArtifactProbe_probe_UnrecognizedProvider(t *testing.T) {
+	testSecret := "test-secret"
+	base := &baseResourceReconciler{
+		GitLab: newGitLabBuilder().
+			withMeta(testMeta).
+			withProviderRef(corev1.ObjectReference{Kind: "SomeOtherProvider"}).
+			build(),
+		client: &test.MockClient{
+			MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+		},
+		status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+	}
+
+	p := newBucketArtifactProbe(base, &secretCredentialSource{client: base.client})
+
+	_, err := p.probe(context.TODO())
+	wantErr := errors.Errorf(errorFmtNotSupportedProvider, "SomeOtherProvider")
+	if diff := cmp.Diff(err, wantErr, cmpErrors); diff != "" {
+		t.Errorf("newBucketArtifactProbe().probe() error %s", diff)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/crossplaneio/gitlab-controller/pkg/apis/controller/v1alpha1"
+)
+
+// conditionBucketPruned is set false on a GitLab resource's bucket status
+// when the bucket pruner fails to enforce a bucket's retention policy.
+const conditionBucketPruned xpcorev1alpha1.ConditionType = "BucketPruned"
+
+const errorFailedToDeleteBucketObjects = "failed to delete bucket objects"
+
+// A bucketDeleter deletes the objects with the given keys from a bucket,
+// using the bucket's connection secret to authenticate. Each supported
+// provider gets its own implementation, dispatched the same way
+// bucketLister is.
+type bucketDeleter interface {
+	delete(ctx context.Context, secret *corev1.Secret, keys []string) error
+}
+
+// defaultBucketDeleters returns the bucketDeleter registered for every
+// provider this controller knows how to delete objects for.
+func defaultBucketDeleters() map[string]bucketDeleter {
+	return map[string]bucketDeleter{
+		providerS3:    &s3BucketDeleter{},
+		providerGCS:   &gcsBucketDeleter{},
+		providerAzure: &azureBucketDeleter{},
+	}
+}
+
+type s3BucketDeleter struct{}
+
+func (d *s3BucketDeleter) delete(ctx context.Context, secret *corev1.Secret, keys []string) error {
+	cfg, err := s3ConfigFromSecret(secret)
+	if err != nil {
+		return err
+	}
+	return s3DeleteObjects(ctx, cfg, keys)
+}
+
+type gcsBucketDeleter struct{}
+
+func (d *gcsBucketDeleter) delete(ctx context.Context, secret *corev1.Secret, keys []string) error {
+	cfg, err := gcsConfigFromSecret(secret)
+	if err != nil {
+		return err
+	}
+	return gcsDeleteObjects(ctx, cfg, keys)
+}
+
+type azureBucketDeleter struct{}
+
+func (d *azureBucketDeleter) delete(ctx context.Context, secret *corev1.Secret, keys []string) error {
+	cfg, err := azureConfigFromSecret(secret)
+	if err != nil {
+		return err
+	}
+	return azureDeleteObjects(ctx, cfg, keys)
+}
+
+// pruneResult is what a bucketPruner did to a bucket.
+type pruneResult struct {
+	PrunedCount int
+}
+
+// A bucketPruner enforces a bucket's retention policy, deleting objects
+// that violate it using the provider-appropriate bucketDeleter.
+type bucketPruner interface {
+	prune(ctx context.Context) (*pruneResult, error)
+}
+
+// defaultBucketPruner is the default bucketPruner. It lists a bucket the
+// same way a bucketArtifactProbe does, computes which objects violate the
+// configured RetentionPolicy, and deletes them using the
+// provider-appropriate bucketDeleter.
+type defaultBucketPruner struct {
+	*baseResourceReconciler
+
+	credentialSource credentialSource
+	policy           *v1alpha1.RetentionPolicy
+	prefix           string
+	listers          map[string]bucketLister
+	deleters         map[string]bucketDeleter
+}
+
+// newBucketPruner returns a bucketPruner for the named bucket of the
+// supplied base reconciler, enforcing policy, and backed by the default,
+// built-in bucketListers and bucketDeleters.
+func newBucketPruner(base *baseResourceReconciler, source credentialSource, policy *v1alpha1.RetentionPolicy) *defaultBucketPruner {
+	return &defaultBucketPruner{
+		baseResourceReconciler: base,
+		credentialSource:       source,
+		policy:                 policy,
+		prefix:                 bucketBackupsPrefix,
+		listers:                defaultBucketListers(),
+		deleters:               defaultBucketDeleters(),
+	}
+}
+
+// provider returns the key under which this pruner looks up its
+// bucketLister and bucketDeleter, derived from the GitLab resource's
+// provider reference.
+func (p *defaultBucketPruner) provider() string {
+	return providerKeyFromRef(p.GitLab.GetProviderRef())
+}
+
+func (p *defaultBucketPruner) prune(ctx context.Context) (*pruneResult, error) {
+	if p.status == nil {
+		return nil, errors.New(errorResourceStatusIsNotFound)
+	}
+
+	secretKey := types.NamespacedName{Namespace: p.GitLab.GetNamespace(), Name: p.status.CredentialsSecretRef.Name}
+
+	source := p.credentialSource
+	if source == nil {
+		source = &secretCredentialSource{client: p.client}
+	}
+	secret, err := source.Fetch(ctx, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, ok := p.listers[p.provider()]
+	if !ok {
+		return nil, errors.Errorf(errorFmtNotSupportedProvider, p.provider())
+	}
+
+	objects, err := lister.list(ctx, secret, p.prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, errorFailedToListBucketObjects)
+	}
+
+	keys := prunableKeys(objects, p.policy)
+	if len(keys) == 0 {
+		return &pruneResult{}, nil
+	}
+
+	deleter, ok := p.deleters[p.provider()]
+	if !ok {
+		return nil, errors.Errorf(errorFmtNotSupportedProvider, p.provider())
+	}
+
+	if err := deleter.delete(ctx, secret, keys); err != nil {
+		return nil, errors.Wrap(err, errorFailedToDeleteBucketObjects)
+	}
+
+	return &pruneResult{PrunedCount: len(keys)}, nil
+}
+
+// prunableKeys returns the keys of the objects, ranked most to least
+// recently modified, that violate policy: those ranked beyond
+// policy.KeepLastN, and/or those older than policy.MaxAge.
+func prunableKeys(objects []bucketObject, policy *v1alpha1.RetentionPolicy) []string {
+	if policy == nil {
+		return nil
+	}
+
+	ranked := make([]bucketObject, len(objects))
+	copy(ranked, objects)
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].LastModified.After(ranked[j].LastModified) })
+
+	var keys []string
+	for i, o := range ranked {
+		tooManyKept := policy.KeepLastN > 0 && i >= policy.KeepLastN
+		tooOld := policy.MaxAge != nil && time.Since(o.LastModified) > policy.MaxAge.Duration
+		if tooManyKept || tooOld {
+			keys = append(keys, o.Key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplaneio/gitlab-controller/pkg/apis/controller/v1alpha1"
+	"github.com/crossplaneio/gitlab-controller/pkg/test"
+)
+
+type mockBucketDeleter struct {
+	mockDelete func(ctx context.Context, secret *corev1.Secret, keys []string) error
+}
+
+func (m *mockBucketDeleter) delete(ctx context.Context, secret *corev1.Secret, keys []string) error {
+	return m.mockDelete(ctx, secret, keys)
+}
+
+func Test_defaultBucketPruner_prune(t *testing.T) {
+	ctx := context.TODO()
+	testError := errors.New("test-error")
+	testSecret := "test-secret"
+	testSecretKey := types.NamespacedName{Namespace: testNamespace, Name: testSecret}
+	oldest := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	newest := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	type fields struct {
+		baseResourceReconciler *baseResourceReconciler
+		policy                 *v1alpha1.RetentionPolicy
+		listers                map[string]bucketLister
+		deleters               map[string]bucketDeleter
+	}
+	tests := map[string]struct {
+		fields  fields
+		want    *pruneResult
+		wantErr error
+	}{
+		"NoStatus": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().build(),
+				},
+			},
+			wantErr: errors.New(errorResourceStatusIsNotFound),
+		},
+		"FailedToRetrieveSecret": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+							return testError
+						},
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+			},
+			wantErr: errors.Wrapf(testError, errorFmtFailedToRetrieveConnectionSecret, testSecretKey),
+		},
+		"NotSupportedProvider": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+				policy: &v1alpha1.RetentionPolicy{KeepLastN: 1},
+			},
+			wantErr: errors.Errorf(errorFmtNotSupportedProvider, providerS3),
+		},
+		"ListFailed": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+				policy: &v1alpha1.RetentionPolicy{KeepLastN: 1},
+				listers: map[string]bucketLister{
+					providerS3: &mockBucketLister{
+						mockList: func(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+							return nil, testError
+						},
+					},
+				},
+			},
+			wantErr: errors.Wrap(testError, errorFailedToListBucketObjects),
+		},
+		"NothingToPrune": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+				policy: &v1alpha1.RetentionPolicy{KeepLastN: 2},
+				listers: map[string]bucketLister{
+					providerS3: &mockBucketLister{
+						mockList: func(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+							return []bucketObject{
+								{Key: "backups/old", LastModified: oldest},
+								{Key: "backups/new", LastModified: newest},
+							}, nil
+						},
+					},
+				},
+			},
+			want: &pruneResult{},
+		},
+		"DeleteFailed": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+				policy: &v1alpha1.RetentionPolicy{KeepLastN: 1},
+				listers: map[string]bucketLister{
+					providerS3: &mockBucketLister{
+						mockList: func(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+							return []bucketObject{
+								{Key: "backups/old", LastModified: oldest},
+								{Key: "backups/new", LastModified: newest},
+							}, nil
+						},
+					},
+				},
+				deleters: map[string]bucketDeleter{
+					providerS3: &mockBucketDeleter{
+						mockDelete: func(ctx context.Context, secret *corev1.Secret, keys []string) error {
+							return testError
+						},
+					},
+				},
+			},
+			wantErr: errors.Wrap(testError, errorFailedToDeleteBucketObjects),
+		},
+		"Successful": {
+			fields: fields{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: newGitLabBuilder().withMeta(testMeta).build(),
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+				policy: &v1alpha1.RetentionPolicy{KeepLastN: 1},
+				listers: map[string]bucketLister{
+					providerS3: &mockBucketLister{
+						mockList: func(ctx context.Context, secret *corev1.Secret, prefix string) ([]bucketObject, error) {
+							return []bucketObject{
+								{Key: "backups/old", LastModified: oldest},
+								{Key: "backups/new", LastModified: newest},
+							}, nil
+						},
+					},
+				},
+				deleters: map[string]bucketDeleter{
+					providerS3: &mockBucketDeleter{
+						mockDelete: func(ctx context.Context, secret *corev1.Secret, keys []string) error {
+							if diff := cmp.Diff(keys, []string{"backups/old"}); diff != "" {
+								t.Errorf("bucketDeleter.delete() -got keys, +want keys: %s", diff)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			want: &pruneResult{PrunedCount: 1},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &defaultBucketPruner{
+				baseResourceReconciler: tt.fields.baseResourceReconciler,
+				policy:                 tt.fields.policy,
+				prefix:                 bucketBackupsPrefix,
+				listers:                tt.fields.listers,
+				deleters:               tt.fields.deleters,
+			}
+			got, err := p.prune(ctx)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("defaultBucketPruner.prune() error %s", diff)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("defaultBucketPruner.prune() -got, +want: %s", diff)
+			}
+		})
+	}
+}
+
+// Test_newBucketPruner_prune_UnrecognizedProvider constructs a pruner via
+// the real newBucketPruner constructor, wired up with the real, built-in
+// bucketListers and bucketDeleters, to confirm that a GitLab resource whose
+// ProviderRef.Kind isn't one this controller recognizes actually surfaces
+// errorFmtNotSupportedProvider rather than being silently treated as S3.
+func Test_newBucketPruner_prune_UnrecognizedProvider(t *testing.T) {
+	testSecret := "test-secret"
+	base := &baseResourceReconciler{
+		GitLab: newGitLabBuilder().
+			withMeta(testMeta).
+			withProviderRef(corev1.ObjectReference{Kind: "SomeOtherProvider"}).
+			build(),
+		client: &test.MockClient{
+			MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+		},
+		status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+	}
+
+	p := newBucketPruner(base, &secretCredentialSource{client: base.client}, &v1alpha1.RetentionPolicy{KeepLastN: 1})
+
+	_, err := p.prune(context.TODO())
+	wantErr := errors.Errorf(errorFmtNotSupportedProvider, "SomeOtherProvider")
+	if diff := cmp.Diff(err, wantErr, cmpErrors); diff != "" {
+		t.Errorf("newBucketPruner().prune() error %s", diff)
+	}
+}
+
+func Test_prunableKeys(t *testing.T) {
+	oldest := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	middle := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	newest := time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)
+	objects := []bucketObject{
+		{Key: "backups/oldest", LastModified: oldest},
+		{Key: "backups/middle", LastModified: middle},
+		{Key: "backups/newest", LastModified: newest},
+	}
+
+	cases := map[string]struct {
+		objects []bucketObject
+		policy  *v1alpha1.RetentionPolicy
+		want    []string
+	}{
+		"NoPolicy": {
+			objects: objects,
+			policy:  nil,
+			want:    nil,
+		},
+		"KeepLastN": {
+			objects: objects,
+			policy:  &v1alpha1.RetentionPolicy{KeepLastN: 1},
+			want:    []string{"backups/middle", "backups/oldest"},
+		},
+		"MaxAge": {
+			objects: objects,
+			policy:  &v1alpha1.RetentionPolicy{MaxAge: &metav1.Duration{Duration: time.Since(middle) + time.Hour}},
+			want:    []string{"backups/oldest"},
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := prunableKeys(tt.objects, tt.policy)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("prunableKeys() -got, +want: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"time"
+
+	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
+	xpstoragev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/storage/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/helm/pkg/chartutil"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplaneio/gitlab-controller/pkg/apis/controller/v1alpha1"
+)
+
+const (
+	bucketClaimKind     = "bucket"
+	bucketNameDelimiter = "-"
+
+	// gitLabAPIVersion and gitLabKind identify the GitLab resource in the
+	// owner references this package sets on the Bucket claims it creates.
+	gitLabAPIVersion = "gitlab.crossplane.io/v1alpha1"
+	gitLabKind       = "GitLab"
+)
+
+// bucketValuesFn renders the Helm values contributed by a single bucket's
+// connection secret, e.g. the bucket's own config stanza or the GitLab
+// backups stanza.
+type bucketValuesFn func(values chartutil.Values, secret *corev1.Secret, name, secretPrefix string) chartutil.Values
+
+// bucketReconciler reconciles a single Crossplane Bucket claim on behalf of
+// a GitLab resource, and transforms its connection secret into the Helm
+// values GitLab needs to talk to that bucket.
+type bucketReconciler struct {
+	*baseResourceReconciler
+
+	secretTransformer secretTransformer
+	credentialSource  credentialSource
+	artifactProbe     bucketArtifactProbe
+	pruner            bucketPruner
+	helmValuesFn      bucketValuesFn
+}
+
+// newBucketReconciler returns a resourceReconciler for the named bucket of
+// the supplied GitLab resource. The bucket's connection credentials are
+// fetched from the credentialSource backend configured in
+// gitlab.Spec.CredentialsBackend, falling back to the in-cluster Secret
+// backend if it cannot be resolved or none is configured.
+func newBucketReconciler(gitlab *v1alpha1.GitLab, c client.Client, name string, helmValuesFn bucketValuesFn) *bucketReconciler {
+	source, err := newCredentialSource(c, gitlab.Spec.CredentialsBackend)
+	if err != nil {
+		source = &secretCredentialSource{client: c}
+	}
+	source = newCachingCredentialSource(source)
+
+	r := &bucketReconciler{
+		baseResourceReconciler: newBaseResourceReconciler(gitlab, c, name),
+		helmValuesFn:           helmValuesFn,
+		credentialSource:       source,
+	}
+	r.resourceClassFinder = &defaultResourceClassFinder{client: c}
+	r.secretTransformer = newGitLabSecretTransformer(r.baseResourceReconciler, source)
+	r.artifactProbe = newBucketArtifactProbe(r.baseResourceReconciler, source)
+	if policy := r.retentionPolicy(); policy != nil {
+		r.pruner = newBucketPruner(r.baseResourceReconciler, source, policy)
+	}
+	return r
+}
+
+// getClaimKind returns the bucket's claim kind, which is used to find the
+// resource class that will satisfy its claim.
+func (r *bucketReconciler) getClaimKind() string {
+	return bucketClaimKind + "-" + r.name
+}
+
+// claimName returns the name of this bucket's Crossplane Bucket claim.
+func (r *bucketReconciler) claimName() string {
+	key := types.NamespacedName{Namespace: r.GitLab.GetNamespace(), Name: r.GitLab.GetName()}
+	return key.String() + "-" + xpstoragev1alpha1.BucketKind + "-" + r.name
+}
+
+// reconcile creates (if necessary) the Crossplane Bucket claim for this
+// bucket, records its status, and transforms its connection secret once it
+// becomes ready. If the GitLab resource is being deleted, it instead applies
+// this bucket's retention policy's delete policy.
+func (r *bucketReconciler) reconcile(ctx context.Context) error {
+	if !r.GitLab.GetDeletionTimestamp().IsZero() {
+		return r.handleDeletion(ctx)
+	}
+
+	providerRef := r.GitLab.GetProviderRef()
+	class, err := r.resourceClassFinder.find(ctx, providerRef, r.getClaimKind())
+	if err != nil {
+		return errors.Wrapf(err, errorFmtFailedToFindResourceClass, r.getClaimKind(), providerRef)
+	}
+
+	claimName := r.claimName()
+
+	bucket := &xpstoragev1alpha1.Bucket{}
+	err = r.client.Get(ctx, types.NamespacedName{Namespace: r.GitLab.GetNamespace(), Name: claimName}, bucket)
+	if kerrors.IsNotFound(err) {
+		bucket.SetNamespace(r.GitLab.GetNamespace())
+		bucket.SetName(claimName)
+		bucket.SetOwnerReferences([]metav1.OwnerReference{r.ownerReference()})
+		bucket.Spec.Name = claimName
+		if class != nil {
+			bucket.Spec.ClassRef = class
+		}
+		if err := r.client.Create(ctx, bucket); err != nil {
+			return errors.Wrapf(err, errorFmtFailedToCreate, r.getClaimKind(), claimName)
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, errorFmtFailedToRetrieveInstance, r.getClaimKind(), claimName)
+	}
+
+	r.status = &bucket.Status
+
+	if !isReady(r.status) {
+		return nil
+	}
+
+	if r.secretTransformer != nil {
+		if err := r.secretTransformer.transform(ctx); err != nil {
+			return err
+		}
+	}
+
+	if r.artifactProbe != nil && r.probeDue() {
+		r.probeBackupHealth(ctx)
+	}
+
+	if r.pruner != nil {
+		r.pruneBackups(ctx)
+	}
+
+	return nil
+}
+
+// ownerReference returns the owner reference this bucket's Bucket claim is
+// created with, identifying the GitLab resource that provisioned it.
+func (r *bucketReconciler) ownerReference() metav1.OwnerReference {
+	controller, blockOwnerDeletion := true, true
+	return metav1.OwnerReference{
+		APIVersion:         gitLabAPIVersion,
+		Kind:               gitLabKind,
+		Name:               r.GitLab.GetName(),
+		UID:                r.GitLab.GetUID(),
+		Controller:         &controller,
+		BlockOwnerDeletion: &blockOwnerDeletion,
+	}
+}
+
+// handleDeletion applies this bucket's retention policy's delete policy now
+// that its GitLab resource is being deleted. A BucketDeletePolicyRetain
+// strips this bucket's owner reference from its Bucket claim so that it
+// survives the GitLab resource's deletion instead of being garbage
+// collected along with it.
+func (r *bucketReconciler) handleDeletion(ctx context.Context) error {
+	policy := r.retentionPolicy()
+	if policy == nil || policy.DeletePolicy != v1alpha1.BucketDeletePolicyRetain {
+		return nil
+	}
+
+	claimName := r.claimName()
+	bucket := &xpstoragev1alpha1.Bucket{}
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: r.GitLab.GetNamespace(), Name: claimName}, bucket); err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, errorFmtFailedToRetrieveInstance, r.getClaimKind(), claimName)
+	}
+
+	bucket.SetOwnerReferences(nil)
+	if err := r.client.Update(ctx, bucket); err != nil {
+		return errors.Wrapf(err, errorFmtFailedToUpdateOwnerReferences, claimName)
+	}
+	return nil
+}
+
+// probeBackupHealth runs the artifact probe and records what it observed
+// into this bucket's entry in the GitLab resource's status, flipping its
+// BackupHealthy condition false if the probe failed or if no new object has
+// appeared within the bucket's configured backupStaleAfter. A probe that
+// finds no objects at all leaves the condition true.
+func (r *bucketReconciler) probeBackupHealth(ctx context.Context) {
+	now := time.Now()
+
+	result, err := r.artifactProbe.probe(ctx)
+	if err != nil {
+		r.updateBucketStatus(func(bs *v1alpha1.BucketStatus) {
+			bs.Conditions = setCondition(bs.Conditions, conditionFalse(conditionBackupHealthy, err.Error()))
+		})
+		return
+	}
+
+	healthy := true
+	if staleAfter := r.backupStaleAfter(); staleAfter != nil && !result.NewestObjectTime.IsZero() {
+		healthy = now.Sub(result.NewestObjectTime) <= staleAfter.Duration
+	}
+
+	cond := conditionTrue(conditionBackupHealthy)
+	if !healthy {
+		cond = conditionFalse(conditionBackupHealthy, "no new backup object observed within backupStaleAfter")
+	}
+	r.updateBucketStatus(func(bs *v1alpha1.BucketStatus) {
+		bs.LastRevision = result.Revision
+		bs.LastObservedTime = metav1.NewTime(now)
+		bs.ObjectCount = result.ObjectCount
+		bs.Conditions = setCondition(bs.Conditions, cond)
+	})
+}
+
+// pruneBackups runs the bucket pruner and records what it pruned into this
+// bucket's entry in the GitLab resource's status, flipping its
+// BucketPruned condition false if the prune failed.
+func (r *bucketReconciler) pruneBackups(ctx context.Context) {
+	result, err := r.pruner.prune(ctx)
+	if err != nil {
+		r.updateBucketStatus(func(bs *v1alpha1.BucketStatus) {
+			bs.Conditions = setCondition(bs.Conditions, conditionFalse(conditionBucketPruned, err.Error()))
+		})
+		return
+	}
+
+	r.updateBucketStatus(func(bs *v1alpha1.BucketStatus) {
+		bs.PrunedCount = result.PrunedCount
+		bs.Conditions = setCondition(bs.Conditions, conditionTrue(conditionBucketPruned))
+	})
+}
+
+// bucketSpec returns this bucket's BucketSpec from the GitLab resource, or
+// nil if it cannot be found, e.g. it has been removed from spec.buckets
+// since this reconciler was constructed.
+func (r *bucketReconciler) bucketSpec() *v1alpha1.BucketSpec {
+	for i := range r.GitLab.Spec.Buckets {
+		if r.GitLab.Spec.Buckets[i].Name == r.name {
+			return &r.GitLab.Spec.Buckets[i]
+		}
+	}
+	return nil
+}
+
+// backupStaleAfter returns this bucket's configured staleness threshold, or
+// nil if none is set.
+func (r *bucketReconciler) backupStaleAfter() *metav1.Duration {
+	if spec := r.bucketSpec(); spec != nil {
+		return spec.BackupStaleAfter
+	}
+	return nil
+}
+
+// probeInterval returns this bucket's configured minimum time between
+// artifact probes, or nil if none is set.
+func (r *bucketReconciler) probeInterval() *metav1.Duration {
+	if spec := r.bucketSpec(); spec != nil {
+		return spec.ProbeInterval
+	}
+	return nil
+}
+
+// probeDue reports whether the artifact probe should run this reconcile:
+// true if this bucket has no configured probeInterval, has never been
+// probed, or was last probed at least probeInterval ago.
+func (r *bucketReconciler) probeDue() bool {
+	interval := r.probeInterval()
+	if interval == nil {
+		return true
+	}
+
+	bs, ok := r.GitLab.Status.Buckets[r.name]
+	if !ok || bs.LastObservedTime.IsZero() {
+		return true
+	}
+	return time.Since(bs.LastObservedTime.Time) >= interval.Duration
+}
+
+// retentionPolicy returns this bucket's configured retention policy, or nil
+// if none is set.
+func (r *bucketReconciler) retentionPolicy() *v1alpha1.RetentionPolicy {
+	if spec := r.bucketSpec(); spec != nil {
+		return spec.Retention
+	}
+	return nil
+}
+
+// updateBucketStatus applies mutate to this bucket's entry in the GitLab
+// resource's status, creating it if it does not yet exist.
+func (r *bucketReconciler) updateBucketStatus(mutate func(*v1alpha1.BucketStatus)) {
+	if r.GitLab.Status.Buckets == nil {
+		r.GitLab.Status.Buckets = map[string]v1alpha1.BucketStatus{}
+	}
+	bs := r.GitLab.Status.Buckets[r.name]
+	mutate(&bs)
+	r.GitLab.Status.Buckets[r.name] = bs
+}
+
+// setCondition returns conditions with cond upserted by type, preserving
+// every other condition already present.
+func setCondition(conditions []xpcorev1alpha1.Condition, cond xpcorev1alpha1.Condition) []xpcorev1alpha1.Condition {
+	for i := range conditions {
+		if conditions[i].Type == cond.Type {
+			conditions[i] = cond
+			return conditions
+		}
+	}
+	return append(conditions, cond)
+}
+
+// getHelmValues renders this bucket's contribution to the GitLab Helm
+// values using its connection secret.
+func (r *bucketReconciler) getHelmValues(ctx context.Context, values chartutil.Values, secretPrefix string) error {
+	if r.status == nil {
+		return errors.New(errorResourceStatusIsNotFound)
+	}
+
+	secretKey := types.NamespacedName{Namespace: r.GitLab.GetNamespace(), Name: r.status.CredentialsSecretRef.Name}
+	source := r.credentialSource
+	if source == nil {
+		source = &secretCredentialSource{client: r.client}
+	}
+	secret, err := source.Fetch(ctx, secretKey)
+	if err != nil {
+		return err
+	}
+
+	if r.helmValuesFn != nil {
+		r.helmValuesFn(values, secret, r.name, secretPrefix)
+	}
+	setValue(values, []string{valuesKeyGlobal, valuesKeyAppConfig, r.name, "provider"}, providerKeyFromRef(r.GitLab.GetProviderRef()))
+
+	return nil
+}
+
+// isReady reports whether a resource claim status has transitioned to the
+// Ready condition.
+func isReady(status *xpcorev1alpha1.ResourceClaimStatus) bool {
+	for _, c := range status.Conditions {
+		if c.Type == xpcorev1alpha1.Ready && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -19,6 +19,7 @@ package gitlab
 import (
 	"context"
 	"testing"
+	"time"
 
 	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
 	xpstoragev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/storage/v1alpha1"
@@ -47,6 +48,22 @@ func (m *mockSecretTransformer) transform(ctx context.Context) error {
 	return m.mockTransform(ctx)
 }
 
+type mockBucketArtifactProbe struct {
+	mockProbe func(context.Context) (*probeResult, error)
+}
+
+func (m *mockBucketArtifactProbe) probe(ctx context.Context) (*probeResult, error) {
+	return m.mockProbe(ctx)
+}
+
+type mockBucketPruner struct {
+	mockPrune func(context.Context) (*pruneResult, error)
+}
+
+func (m *mockBucketPruner) prune(ctx context.Context) (*pruneResult, error) {
+	return m.mockPrune(ctx)
+}
+
 type mockSecretUpdater struct {
 	mockUpdate func(*corev1.Secret) error
 }
@@ -95,10 +112,12 @@ func Test_bucketReconciler_reconcile(t *testing.T) {
 		bucketName  string
 		finder      resourceClassFinder
 		transformer secretTransformer
+		probe       bucketArtifactProbe
 	}
 	type want struct {
-		err    error
-		status *xpcorev1alpha1.ResourceClaimStatus
+		err         error
+		status      *xpcorev1alpha1.ResourceClaimStatus
+		prunerWired bool
 	}
 	tests := map[string]struct {
 		fields fields
@@ -186,6 +205,31 @@ func Test_bucketReconciler_reconcile(t *testing.T) {
 			},
 			want: want{},
 		},
+		"CreateSuccessfulWithRetentionPolicy": {
+			fields: fields{
+				gitlab: newGitLabBuilder().withMeta(testMeta).
+					withBuckets(v1alpha1.BucketSpec{Name: testBucket, Retention: &v1alpha1.RetentionPolicy{KeepLastN: 2}}).
+					build(),
+				client: &test.MockClient{
+					MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+						assertBucketName(obj)
+						return kerrors.NewNotFound(schema.GroupResource{}, "")
+					},
+					MockCreate: func(ctx context.Context, obj runtime.Object) error {
+						assertBucketName(obj)
+						return nil
+					},
+				},
+				finder: &mockResourceClassFinder{
+					mockFind: func(ctx context.Context, provider corev1.ObjectReference,
+						resource string) (*corev1.ObjectReference, error) {
+						return nil, nil
+					},
+				},
+				bucketName: testBucket,
+			},
+			want: want{prunerWired: true},
+		},
 		"SuccessfulNotReady": {
 			fields: fields{
 				gitlab: newGitLabBuilder().withMeta(testMeta).build(),
@@ -241,12 +285,112 @@ func Test_bucketReconciler_reconcile(t *testing.T) {
 				status: newResourceClaimStatusBuilder().withReadyStatus().build(),
 			},
 		},
+		"SuccessfulReadyWithRetentionPolicy": {
+			fields: fields{
+				gitlab: newGitLabBuilder().withMeta(testMeta).
+					withBuckets(v1alpha1.BucketSpec{Name: testBucket, Retention: &v1alpha1.RetentionPolicy{KeepLastN: 2}}).
+					build(),
+				client: &test.MockClient{
+					MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+						b := assertBucketName(obj)
+						b.Status = *newResourceClaimStatusBuilder().withReadyStatus().build()
+						return nil
+					},
+					MockCreate: func(ctx context.Context, obj runtime.Object) error {
+						assertBucketName(obj)
+						return nil
+					},
+				},
+				finder: &mockResourceClassFinder{
+					mockFind: func(ctx context.Context, provider corev1.ObjectReference,
+						resource string) (*corev1.ObjectReference, error) {
+						return nil, nil
+					},
+				},
+				transformer: &mockSecretTransformer{
+					mockTransform: func(ctx context.Context) error { return nil },
+				},
+				bucketName: testBucket,
+			},
+			want: want{
+				status:      newResourceClaimStatusBuilder().withReadyStatus().build(),
+				prunerWired: true,
+			},
+		},
+		"SuccessfulReadyWithArtifactProbe": {
+			fields: fields{
+				gitlab: newGitLabBuilder().withMeta(testMeta).build(),
+				client: &test.MockClient{
+					MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+						b := assertBucketName(obj)
+						b.Status = *newResourceClaimStatusBuilder().withReadyStatus().build()
+						return nil
+					},
+					MockCreate: func(ctx context.Context, obj runtime.Object) error {
+						assertBucketName(obj)
+						return nil
+					},
+				},
+				finder: &mockResourceClassFinder{
+					mockFind: func(ctx context.Context, provider corev1.ObjectReference,
+						resource string) (*corev1.ObjectReference, error) {
+						return nil, nil
+					},
+				},
+				transformer: &mockSecretTransformer{
+					mockTransform: func(ctx context.Context) error { return nil },
+				},
+				probe: &mockBucketArtifactProbe{
+					mockProbe: func(ctx context.Context) (*probeResult, error) {
+						return &probeResult{Revision: "test-revision", ObjectCount: 1}, nil
+					},
+				},
+				bucketName: testBucket,
+			},
+			want: want{
+				status: newResourceClaimStatusBuilder().withReadyStatus().build(),
+			},
+		},
+		"DeletionWithRetainPolicy": {
+			fields: fields{
+				gitlab: newGitLabBuilder().withMeta(testMeta).
+					withDeletionTimestamp(metav1.Now()).
+					withBuckets(v1alpha1.BucketSpec{
+						Name:      testBucket,
+						Retention: &v1alpha1.RetentionPolicy{DeletePolicy: v1alpha1.BucketDeletePolicyRetain},
+					}).
+					build(),
+				client: &test.MockClient{
+					MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+						b := assertBucketObject(t, testCaseName, obj)
+						b.SetOwnerReferences([]metav1.OwnerReference{{Name: testName}})
+						return nil
+					},
+					MockUpdate: func(ctx context.Context, obj runtime.Object) error {
+						b := assertBucketObject(t, testCaseName, obj)
+						if diff := cmp.Diff(b.GetOwnerReferences(), []metav1.OwnerReference(nil)); diff != "" {
+							t.Errorf("%s -got owner references, +want owner references: %s", testCaseName, diff)
+						}
+						return nil
+					},
+				},
+				bucketName: testBucket,
+			},
+			want: want{prunerWired: true},
+		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			r := newBucketReconciler(tt.fields.gitlab, tt.fields.client, tt.fields.bucketName, newMockHelmValuesFn(nil))
+			if diff := cmp.Diff(r.pruner != nil, tt.want.prunerWired); diff != "" {
+				t.Errorf("%s -got pruner wired, +want pruner wired: %s", testCaseName, diff)
+			}
 			r.resourceClassFinder = tt.fields.finder
 			r.secretTransformer = tt.fields.transformer
+			r.artifactProbe = tt.fields.probe
+			if r.pruner != nil {
+				r.pruner = &mockBucketPruner{mockPrune: func(ctx context.Context) (*pruneResult, error) { return &pruneResult{}, nil }}
+			}
 
 			if diff := cmp.Diff(r.reconcile(ctx), tt.want.err, cmpErrors); diff != "" {
 				t.Errorf("%s -got error, +want error: %s", testCaseName, diff)
@@ -254,6 +398,125 @@ func Test_bucketReconciler_reconcile(t *testing.T) {
 			if diff := cmp.Diff(r.status, tt.want.status, cmp.Comparer(test.EqualConditionedStatus)); diff != "" {
 				t.Errorf("%s -got status, +want status: %s", testCaseName, diff)
 			}
+			if tt.fields.probe != nil {
+				bs := tt.fields.gitlab.Status.Buckets[tt.fields.bucketName]
+				if diff := cmp.Diff(bs.LastRevision, "test-revision"); diff != "" {
+					t.Errorf("%s -got bucket status, +want bucket status: %s", testCaseName, diff)
+				}
+			}
+		})
+	}
+}
+
+func Test_bucketReconciler_probeBackupHealth(t *testing.T) {
+	ctx := context.TODO()
+	testError := errors.New("test-error")
+	staleAfter := &metav1.Duration{Duration: time.Hour}
+
+	type fields struct {
+		gitlab *v1alpha1.GitLab
+		probe  bucketArtifactProbe
+	}
+	tests := map[string]struct {
+		fields        fields
+		wantCondition xpcorev1alpha1.Condition
+	}{
+		"ProbeFailed": {
+			fields: fields{
+				gitlab: newGitLabBuilder().withMeta(testMeta).build(),
+				probe: &mockBucketArtifactProbe{
+					mockProbe: func(ctx context.Context) (*probeResult, error) { return nil, testError },
+				},
+			},
+			wantCondition: conditionFalse(conditionBackupHealthy, testError.Error()),
+		},
+		"Healthy": {
+			fields: fields{
+				gitlab: newGitLabBuilder().withMeta(testMeta).withBuckets(v1alpha1.BucketSpec{Name: testBucket, BackupStaleAfter: staleAfter}).build(),
+				probe: &mockBucketArtifactProbe{
+					mockProbe: func(ctx context.Context) (*probeResult, error) {
+						return &probeResult{Revision: "test-revision", ObjectCount: 3, NewestObjectTime: time.Now()}, nil
+					},
+				},
+			},
+			wantCondition: conditionTrue(conditionBackupHealthy),
+		},
+		"Stale": {
+			fields: fields{
+				gitlab: newGitLabBuilder().withMeta(testMeta).withBuckets(v1alpha1.BucketSpec{Name: testBucket, BackupStaleAfter: staleAfter}).build(),
+				probe: &mockBucketArtifactProbe{
+					mockProbe: func(ctx context.Context) (*probeResult, error) {
+						return &probeResult{Revision: "test-revision", ObjectCount: 3, NewestObjectTime: time.Now().Add(-2 * time.Hour)}, nil
+					},
+				},
+			},
+			wantCondition: conditionFalse(conditionBackupHealthy, "no new backup object observed within backupStaleAfter"),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &bucketReconciler{
+				baseResourceReconciler: newBaseResourceReconciler(tt.fields.gitlab, test.NewMockClient(), testBucket),
+				artifactProbe:          tt.fields.probe,
+			}
+			r.probeBackupHealth(ctx)
+
+			got := r.GitLab.Status.Buckets[testBucket].Conditions
+			want := []xpcorev1alpha1.Condition{tt.wantCondition}
+			if diff := cmp.Diff(got, want, cmp.Comparer(func(a, b xpcorev1alpha1.Condition) bool {
+				return a.Type == b.Type && a.Status == b.Status && a.Message == b.Message
+			})); diff != "" {
+				t.Errorf("Test_bucketReconciler_probeBackupHealth() %s: -got condition, +want condition: %s", name, diff)
+			}
+		})
+	}
+}
+
+func Test_bucketReconciler_probeDue(t *testing.T) {
+	interval := &metav1.Duration{Duration: time.Hour}
+
+	cases := map[string]struct {
+		gitlab *v1alpha1.GitLab
+		want   bool
+	}{
+		"NoInterval": {
+			gitlab: newGitLabBuilder().withMeta(testMeta).build(),
+			want:   true,
+		},
+		"NeverProbed": {
+			gitlab: newGitLabBuilder().withMeta(testMeta).
+				withBuckets(v1alpha1.BucketSpec{Name: testBucket, ProbeInterval: interval}).build(),
+			want: true,
+		},
+		"IntervalNotElapsed": {
+			gitlab: func() *v1alpha1.GitLab {
+				g := newGitLabBuilder().withMeta(testMeta).
+					withBuckets(v1alpha1.BucketSpec{Name: testBucket, ProbeInterval: interval}).build()
+				g.Status.Buckets = map[string]v1alpha1.BucketStatus{
+					testBucket: {LastObservedTime: metav1.NewTime(time.Now().Add(-time.Minute))},
+				}
+				return g
+			}(),
+			want: false,
+		},
+		"IntervalElapsed": {
+			gitlab: func() *v1alpha1.GitLab {
+				g := newGitLabBuilder().withMeta(testMeta).
+					withBuckets(v1alpha1.BucketSpec{Name: testBucket, ProbeInterval: interval}).build()
+				g.Status.Buckets = map[string]v1alpha1.BucketStatus{
+					testBucket: {LastObservedTime: metav1.NewTime(time.Now().Add(-2 * time.Hour))},
+				}
+				return g
+			}(),
+			want: true,
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &bucketReconciler{baseResourceReconciler: newBaseResourceReconciler(tt.gitlab, test.NewMockClient(), testBucket)}
+			if diff := cmp.Diff(r.probeDue(), tt.want); diff != "" {
+				t.Errorf("bucketReconciler.probeDue() -got, +want: %s", diff)
+			}
 		})
 	}
 }
@@ -301,6 +564,50 @@ func Test_bucketReconciler_getHelmValues(t *testing.T) {
 	}
 }
 
+func Test_bucketReconciler_getHelmValues_Provider(t *testing.T) {
+	ctx := context.TODO()
+	testSecret := "test-secret"
+
+	cases := map[string]struct {
+		providerRef corev1.ObjectReference
+		want        string
+	}{
+		"GCS": {
+			providerRef: corev1.ObjectReference{Kind: "GCPProvider"},
+			want:        providerGCS,
+		},
+		"Azure": {
+			providerRef: corev1.ObjectReference{Kind: "AzureProvider"},
+			want:        providerAzure,
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			gitlab := newGitLabBuilder().withMeta(testMeta).withProviderRef(tt.providerRef).build()
+			r := &bucketReconciler{
+				baseResourceReconciler: &baseResourceReconciler{
+					GitLab: gitlab,
+					client: &test.MockClient{
+						MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+					},
+					name:   testBucket,
+					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+				},
+			}
+
+			values := chartutil.Values{}
+			if err := r.getHelmValues(ctx, values, ""); err != nil {
+				t.Fatalf("bucketReconciler.getHelmValues() error = %s, want nil", err)
+			}
+
+			got := values[valuesKeyGlobal].(chartutil.Values)[valuesKeyAppConfig].(chartutil.Values)[testBucket].(chartutil.Values)["provider"]
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("bucketReconciler.getHelmValues() -got provider, +want provider: %s", diff)
+			}
+		})
+	}
+}
+
 func Test_gitlabSecretTransformer_transform(t *testing.T) {
 	ctx := context.TODO()
 	testError := errors.New("test-error")
@@ -346,7 +653,7 @@ func Test_gitlabSecretTransformer_transform(t *testing.T) {
 					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
 				},
 			},
-			wantErr: errors.Errorf(errorFmtNotSupportedProvider, ""),
+			wantErr: errors.Errorf(errorFmtNotSupportedProvider, providerS3),
 		},
 		"UpdaterFailed": {
 			fields: fields{
@@ -358,7 +665,7 @@ func Test_gitlabSecretTransformer_transform(t *testing.T) {
 					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
 				},
 				secretUpdaters: map[string]secretUpdater{
-					"": &mockSecretUpdater{
+					providerS3: &mockSecretUpdater{
 						mockUpdate: func(secret *corev1.Secret) error { return testError },
 					},
 				},
@@ -376,7 +683,7 @@ func Test_gitlabSecretTransformer_transform(t *testing.T) {
 					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
 				},
 				secretUpdaters: map[string]secretUpdater{
-					"": &mockSecretUpdater{
+					providerS3: &mockSecretUpdater{
 						mockUpdate: func(secret *corev1.Secret) error { return nil },
 					},
 				},
@@ -394,7 +701,7 @@ func Test_gitlabSecretTransformer_transform(t *testing.T) {
 					status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
 				},
 				secretUpdaters: map[string]secretUpdater{
-					"": &mockSecretUpdater{
+					providerS3: &mockSecretUpdater{
 						mockUpdate: func(secret *corev1.Secret) error { return nil },
 					},
 				},
@@ -414,6 +721,34 @@ func Test_gitlabSecretTransformer_transform(t *testing.T) {
 	}
 }
 
+// Test_newGitLabSecretTransformer_transform_UnrecognizedProvider constructs
+// a transformer via the real newGitLabSecretTransformer constructor, wired
+// up with the real, built-in secretUpdaters, to confirm that a GitLab
+// resource whose ProviderRef.Kind isn't one this controller recognizes
+// actually surfaces errorFmtNotSupportedProvider rather than being silently
+// treated as S3.
+func Test_newGitLabSecretTransformer_transform_UnrecognizedProvider(t *testing.T) {
+	testSecret := "test-secret"
+	base := &baseResourceReconciler{
+		GitLab: newGitLabBuilder().
+			withMeta(testMeta).
+			withProviderRef(corev1.ObjectReference{Kind: "SomeOtherProvider"}).
+			build(),
+		client: &test.MockClient{
+			MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+		},
+		status: newResourceClaimStatusBuilder().withCredentialsSecretRef(testSecret).build(),
+	}
+
+	tr := newGitLabSecretTransformer(base, &secretCredentialSource{client: base.client})
+
+	err := tr.transform(context.TODO())
+	wantErr := errors.Errorf(errorFmtNotSupportedProvider, "SomeOtherProvider")
+	if diff := cmp.Diff(err, wantErr, cmpErrors); diff != "" {
+		t.Errorf("newGitLabSecretTransformer().transform() error %s", diff)
+	}
+}
+
 func Test_bucketConnectionHelmValues(t *testing.T) {
 	endpoint := "gcs://coolBucket"
 	bucketName := "coolBucket"
@@ -0,0 +1,373 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplaneio/gitlab-controller/pkg/apis/controller/v1alpha1"
+)
+
+const (
+	// CredentialsBackendSecret is the default credentialSource: the
+	// Crossplane-managed in-cluster Secret referenced by a resource claim's
+	// status.credentialsSecretRef.
+	CredentialsBackendSecret = "Secret"
+	// CredentialsBackendVault sources credentials from a HashiCorp Vault
+	// KV v2 secrets engine.
+	CredentialsBackendVault = "Vault"
+	// CredentialsBackendAzureKeyVault sources credentials from an Azure Key
+	// Vault.
+	CredentialsBackendAzureKeyVault = "AzureKeyVault"
+)
+
+const errorFmtUnsupportedCredentialsBackend = "credentials backend %q is not supported"
+
+// Keys an external credentialSource's AuthRef Secret is expected to carry.
+const (
+	keyVaultToken          = "VAULT_TOKEN"
+	keyAzureADTenantID     = "AZURE_TENANT_ID"
+	keyAzureADClientID     = "AZURE_CLIENT_ID"
+	keyAzureADClientSecret = "AZURE_CLIENT_SECRET"
+)
+
+const (
+	// vaultKVv2Mount is the mount point this controller reads credentials
+	// from. Vault KV v2 engines are conventionally mounted at "secret".
+	vaultKVv2Mount = "secret"
+
+	azureADTokenScope   = "https://vault.azure.net/.default"
+	azureKeyVaultAPIVer = "7.4"
+)
+
+const errorFailedToRetrieveAuthSecret = "failed to retrieve credentials backend auth secret"
+
+// A credentialSource fetches the Secret backing a resource claim's
+// connection credentials from wherever they actually live, whether that is
+// the in-cluster Secret Crossplane writes or a long-lived external secret
+// store.
+type credentialSource interface {
+	Fetch(ctx context.Context, ref types.NamespacedName) (*corev1.Secret, error)
+}
+
+// newCredentialSource returns the credentialSource configured by the
+// supplied GitLab resource's spec.credentialsBackend, defaulting to the
+// in-cluster Secret backend when none is set.
+func newCredentialSource(c client.Client, backend v1alpha1.CredentialsBackend) (credentialSource, error) {
+	switch backend.Type {
+	case "", CredentialsBackendSecret:
+		return &secretCredentialSource{client: c}, nil
+	case CredentialsBackendVault:
+		return newVaultCredentialSource(c, backend)
+	case CredentialsBackendAzureKeyVault:
+		return newAzureKeyVaultCredentialSource(c, backend)
+	default:
+		return nil, errors.Errorf(errorFmtUnsupportedCredentialsBackend, backend.Type)
+	}
+}
+
+// secretCredentialSource fetches credentials from the in-cluster Secret a
+// Crossplane resource claim's status.credentialsSecretRef points to. This is
+// the credentialSource every GitLab resource used before backends became
+// pluggable.
+type secretCredentialSource struct {
+	client client.Client
+}
+
+func (s *secretCredentialSource) Fetch(ctx context.Context, ref types.NamespacedName) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := s.client.Get(ctx, ref, secret); err != nil {
+		return nil, errors.Wrapf(err, errorFmtFailedToRetrieveConnectionSecret, ref)
+	}
+	return secret, nil
+}
+
+// cachingCredentialSource wraps a credentialSource, caching the secret
+// returned by its first successful Fetch for a given ref so that repeat
+// Fetches for the same ref within a single reconcile don't hit the backend
+// again. bucketReconciler wraps every bucket's credentialSource in one of
+// these, since its secretTransformer, artifactProbe, pruner, and Helm
+// values renderer each otherwise fetch the same connection secret
+// independently.
+type cachingCredentialSource struct {
+	credentialSource
+
+	cache map[types.NamespacedName]*corev1.Secret
+}
+
+// newCachingCredentialSource returns a credentialSource that memoizes
+// source's Fetch results for the lifetime of the returned value.
+func newCachingCredentialSource(source credentialSource) *cachingCredentialSource {
+	return &cachingCredentialSource{credentialSource: source, cache: map[types.NamespacedName]*corev1.Secret{}}
+}
+
+func (s *cachingCredentialSource) Fetch(ctx context.Context, ref types.NamespacedName) (*corev1.Secret, error) {
+	if secret, ok := s.cache[ref]; ok {
+		return secret, nil
+	}
+
+	secret, err := s.credentialSource.Fetch(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	s.cache[ref] = secret
+	return secret, nil
+}
+
+// fetchAuthSecret retrieves the Secret an external credentialSource's
+// AuthRef points to, the in-cluster credentials it uses to authenticate to
+// the backend itself.
+func fetchAuthSecret(ctx context.Context, c client.Client, authRef corev1.ObjectReference) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: authRef.Namespace, Name: authRef.Name}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return nil, errors.Wrap(err, errorFailedToRetrieveAuthSecret)
+	}
+	return secret, nil
+}
+
+// authSecretValue returns the value of the named key in secret, or an error
+// if it is missing.
+func authSecretValue(secret *corev1.Secret, key string) (string, error) {
+	v, ok := secret.Data[key]
+	if !ok {
+		return "", errors.Errorf(errorFmtMissingSecretKey, key)
+	}
+	return string(v), nil
+}
+
+// doCredentialSourceRequest executes req and returns its response body,
+// erroring out if the request itself fails or the backend responds with a
+// non-200 status.
+func doCredentialSourceRequest(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("credentials backend request failed with status %s: %s", resp.Status, body)
+	}
+	return body, nil
+}
+
+// vaultCredentialSource fetches credentials from a HashiCorp Vault KV v2
+// secrets engine, authenticating with a token read from an in-cluster auth
+// Secret. A resource claim's ref namespace and name are used as the path
+// under the KV v2 mount its credentials are stored at.
+type vaultCredentialSource struct {
+	client  client.Client
+	address string
+	authRef corev1.ObjectReference
+}
+
+func newVaultCredentialSource(c client.Client, backend v1alpha1.CredentialsBackend) (*vaultCredentialSource, error) {
+	if backend.Address == "" {
+		return nil, errors.New("vault credentials backend requires an address")
+	}
+	return &vaultCredentialSource{client: c, address: backend.Address, authRef: backend.AuthRef}, nil
+}
+
+// vaultKVv2Response is the body of a Vault KV v2 secret read response.
+type vaultKVv2Response struct {
+	Data struct {
+		Data map[string]string `json:"data"`
+	} `json:"data"`
+}
+
+func (s *vaultCredentialSource) Fetch(ctx context.Context, ref types.NamespacedName) (*corev1.Secret, error) {
+	authSecret, err := fetchAuthSecret(ctx, s.client, s.authRef)
+	if err != nil {
+		return nil, err
+	}
+	token, err := authSecretValue(authSecret, keyVaultToken)
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%s/v1/%s/data/%s/%s", strings.TrimSuffix(s.address, "/"), vaultKVv2Mount, ref.Namespace, ref.Name)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Vault-Token", token)
+
+	body, err := doCredentialSourceRequest(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read vault secret")
+	}
+
+	kv := &vaultKVv2Response{}
+	if err := json.Unmarshal(body, kv); err != nil {
+		return nil, errors.Wrap(err, "failed to parse vault secret response")
+	}
+
+	data := make(map[string][]byte, len(kv.Data.Data))
+	for k, v := range kv.Data.Data {
+		data[k] = []byte(v)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+		Data:       data,
+	}, nil
+}
+
+// azureKeyVaultCredentialSource fetches credentials from an Azure Key
+// Vault, authenticating as an Azure AD service principal whose tenant,
+// client ID, and client secret are read from an in-cluster auth Secret. A
+// resource claim's ref namespace and name, joined with a dash, are used as
+// the Key Vault secret name its credentials are stored at.
+type azureKeyVaultCredentialSource struct {
+	client  client.Client
+	address string
+	authRef corev1.ObjectReference
+
+	// adEndpoint overrides the Azure AD token endpoint. Left empty outside
+	// of tests, in which case azureADDefaultEndpoint is used.
+	adEndpoint string
+}
+
+func newAzureKeyVaultCredentialSource(c client.Client, backend v1alpha1.CredentialsBackend) (*azureKeyVaultCredentialSource, error) {
+	if backend.Address == "" {
+		return nil, errors.New("azure key vault credentials backend requires an address")
+	}
+	return &azureKeyVaultCredentialSource{client: c, address: backend.Address, authRef: backend.AuthRef}, nil
+}
+
+// azureADDefaultEndpoint is the real-world Azure AD token endpoint.
+const azureADDefaultEndpoint = "https://login.microsoftonline.com"
+
+// azureADTokenResponse is the body of an Azure AD client credentials token
+// response.
+type azureADTokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+// azureKeyVaultSecretResponse is the body of an Azure Key Vault get-secret
+// response. Its Value is expected to be a JSON object of string keys and
+// values, since Key Vault secrets are otherwise limited to a single string.
+type azureKeyVaultSecretResponse struct {
+	Value string `json:"value"`
+}
+
+func (s *azureKeyVaultCredentialSource) Fetch(ctx context.Context, ref types.NamespacedName) (*corev1.Secret, error) {
+	authSecret, err := fetchAuthSecret(ctx, s.client, s.authRef)
+	if err != nil {
+		return nil, err
+	}
+	tenantID, err := authSecretValue(authSecret, keyAzureADTenantID)
+	if err != nil {
+		return nil, err
+	}
+	clientID, err := authSecretValue(authSecret, keyAzureADClientID)
+	if err != nil {
+		return nil, err
+	}
+	clientSecret, err := authSecretValue(authSecret, keyAzureADClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.azureADToken(ctx, tenantID, clientID, clientSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to obtain azure ad token")
+	}
+
+	secretName := ref.Namespace + "-" + ref.Name
+	u := fmt.Sprintf("%s/secrets/%s?api-version=%s", strings.TrimSuffix(s.address, "/"), secretName, azureKeyVaultAPIVer)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	body, err := doCredentialSourceRequest(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read azure key vault secret")
+	}
+
+	kv := &azureKeyVaultSecretResponse{}
+	if err := json.Unmarshal(body, kv); err != nil {
+		return nil, errors.Wrap(err, "failed to parse azure key vault secret response")
+	}
+
+	values := map[string]string{}
+	if err := json.Unmarshal([]byte(kv.Value), &values); err != nil {
+		return nil, errors.Wrap(err, "failed to parse azure key vault secret value")
+	}
+
+	data := make(map[string][]byte, len(values))
+	for k, v := range values {
+		data[k] = []byte(v)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+		Data:       data,
+	}, nil
+}
+
+// azureADToken obtains an Azure AD access token for the Key Vault audience
+// using the OAuth2 client credentials grant.
+func (s *azureKeyVaultCredentialSource) azureADToken(ctx context.Context, tenantID, clientID, clientSecret string) (string, error) {
+	endpoint := s.adEndpoint
+	if endpoint == "" {
+		endpoint = azureADDefaultEndpoint
+	}
+	u := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(endpoint, "/"), tenantID)
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"scope":         {azureADTokenScope},
+	}
+	req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := doCredentialSourceRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	token := &azureADTokenResponse{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplaneio/gitlab-controller/pkg/test"
+)
+
+func Test_secretCredentialSource_Fetch(t *testing.T) {
+	ctx := context.TODO()
+	testError := errors.New("test-error")
+	ref := types.NamespacedName{Namespace: testNamespace, Name: "test-secret"}
+	testSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name}}
+
+	cases := map[string]struct {
+		client  client.Client
+		want    *corev1.Secret
+		wantErr error
+	}{
+		"GetFailed": {
+			client: &test.MockClient{
+				MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return testError },
+			},
+			wantErr: errors.Wrapf(testError, errorFmtFailedToRetrieveConnectionSecret, ref),
+		},
+		"Successful": {
+			client: &test.MockClient{
+				MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+					*obj.(*corev1.Secret) = *testSecret
+					return nil
+				},
+			},
+			want: testSecret,
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := &secretCredentialSource{client: tt.client}
+			got, err := s.Fetch(ctx, ref)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("Fetch() error %s", diff)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Fetch() -got, +want: %s", diff)
+			}
+		})
+	}
+}
+
+type mockCredentialSource struct {
+	mockFetch func(ctx context.Context, ref types.NamespacedName) (*corev1.Secret, error)
+}
+
+func (m *mockCredentialSource) Fetch(ctx context.Context, ref types.NamespacedName) (*corev1.Secret, error) {
+	return m.mockFetch(ctx, ref)
+}
+
+func Test_cachingCredentialSource_Fetch(t *testing.T) {
+	ctx := context.TODO()
+	testError := errors.New("test-error")
+	ref := types.NamespacedName{Namespace: testNamespace, Name: "test-secret"}
+	testSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name}}
+
+	var fetches int
+	source := newCachingCredentialSource(&mockCredentialSource{
+		mockFetch: func(ctx context.Context, ref types.NamespacedName) (*corev1.Secret, error) {
+			fetches++
+			return testSecret, nil
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		got, err := source.Fetch(ctx, ref)
+		if err != nil {
+			t.Fatalf("Fetch() error = %s, want nil", err)
+		}
+		if diff := cmp.Diff(got, testSecret); diff != "" {
+			t.Errorf("Fetch() -got, +want: %s", diff)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Fetch() invoked the wrapped credentialSource %d times, want 1", fetches)
+	}
+
+	failing := newCachingCredentialSource(&mockCredentialSource{
+		mockFetch: func(ctx context.Context, ref types.NamespacedName) (*corev1.Secret, error) {
+			return nil, testError
+		},
+	})
+	if _, err := failing.Fetch(ctx, ref); err != testError {
+		t.Errorf("Fetch() error = %v, want %v", err, testError)
+	}
+}
+
+func Test_vaultCredentialSource_Fetch(t *testing.T) {
+	ctx := context.TODO()
+	testError := errors.New("test-error")
+	ref := types.NamespacedName{Namespace: testNamespace, Name: "test-secret"}
+	authRef := corev1.ObjectReference{Namespace: testNamespace, Name: "vault-auth"}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			http.Error(w, "missing or wrong vault token", http.StatusForbidden)
+			return
+		}
+		wantPath := fmt.Sprintf("/v1/secret/data/%s/%s", ref.Namespace, ref.Name)
+		if r.URL.Path != wantPath {
+			http.Error(w, "unexpected path", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"data":{"AWS_ACCESS_KEY_ID":"id","AWS_SECRET_ACCESS_KEY":"secret"}}}`)
+	}))
+	defer srv.Close()
+
+	cases := map[string]struct {
+		client  client.Client
+		want    *corev1.Secret
+		wantErr error
+	}{
+		"FailedToRetrieveAuthSecret": {
+			client: &test.MockClient{
+				MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return testError },
+			},
+			wantErr: errors.Wrap(testError, errorFailedToRetrieveAuthSecret),
+		},
+		"MissingVaultToken": {
+			client: &test.MockClient{
+				MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+			},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyVaultToken),
+		},
+		"Successful": {
+			client: &test.MockClient{
+				MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+					obj.(*corev1.Secret).Data = map[string][]byte{keyVaultToken: []byte("test-token")}
+					return nil
+				},
+			},
+			want: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+				Data: map[string][]byte{
+					keyAWSAccessKeyID:     []byte("id"),
+					keyAWSSecretAccessKey: []byte("secret"),
+				},
+			},
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := &vaultCredentialSource{client: tt.client, address: srv.URL, authRef: authRef}
+			got, err := s.Fetch(ctx, ref)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("Fetch() error %s", diff)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Fetch() -got, +want: %s", diff)
+			}
+		})
+	}
+}
+
+func Test_azureKeyVaultCredentialSource_Fetch(t *testing.T) {
+	ctx := context.TODO()
+	testError := errors.New("test-error")
+	ref := types.NamespacedName{Namespace: testNamespace, Name: "test-secret"}
+	authRef := corev1.ObjectReference{Namespace: testNamespace, Name: "azure-auth"}
+
+	vaultSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-access-token" {
+			http.Error(w, "missing or wrong bearer token", http.StatusForbidden)
+			return
+		}
+		wantPath := "/secrets/" + ref.Namespace + "-" + ref.Name
+		if r.URL.Path != wantPath {
+			http.Error(w, "unexpected path", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"value":"{\"AZURE_STORAGE_ACCOUNT_NAME\":\"account\",\"AZURE_STORAGE_ACCOUNT_KEY\":\"key\"}"}`)
+	}))
+	defer vaultSrv.Close()
+
+	adSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Form.Get("client_id") != "test-client" || r.Form.Get("client_secret") != "test-secret" {
+			http.Error(w, "bad client credentials", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"test-access-token"}`)
+	}))
+	defer adSrv.Close()
+
+	cases := map[string]struct {
+		client  client.Client
+		wantErr error
+	}{
+		"FailedToRetrieveAuthSecret": {
+			client: &test.MockClient{
+				MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return testError },
+			},
+			wantErr: errors.Wrap(testError, errorFailedToRetrieveAuthSecret),
+		},
+		"MissingTenantID": {
+			client: &test.MockClient{
+				MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+			},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyAzureADTenantID),
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := &azureKeyVaultCredentialSource{client: tt.client, address: vaultSrv.URL, authRef: authRef, adEndpoint: adSrv.URL}
+			_, err := s.Fetch(ctx, ref)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("Fetch() error %s", diff)
+			}
+		})
+	}
+
+	t.Run("Successful", func(t *testing.T) {
+		c := &test.MockClient{
+			MockGet: func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+				obj.(*corev1.Secret).Data = map[string][]byte{
+					keyAzureADTenantID:     []byte("test-tenant"),
+					keyAzureADClientID:     []byte("test-client"),
+					keyAzureADClientSecret: []byte("test-secret"),
+				}
+				return nil
+			},
+		}
+		s := &azureKeyVaultCredentialSource{client: c, address: vaultSrv.URL, authRef: authRef, adEndpoint: adSrv.URL}
+
+		got, err := s.Fetch(ctx, ref)
+		if err != nil {
+			t.Fatalf("Fetch() error = %s", err)
+		}
+		want := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name},
+			Data: map[string][]byte{
+				keyAzureStorageAccount: []byte("account"),
+				keyAzureStorageKey:     []byte("key"),
+			},
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("Fetch() -got, +want: %s", diff)
+		}
+	})
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Connection secret keys a gcsConfig is read from, alongside the service
+// account keys a gcsSecretUpdater already expects to find there.
+const keyGCPBucketName = "GCP_BUCKET_NAME"
+
+// gcsDefaultEndpoint is the real-world GCS JSON API endpoint.
+const gcsDefaultEndpoint = "https://storage.googleapis.com/storage/v1"
+
+// gcsTokenScope is the OAuth2 scope requested for the service account
+// token used to list and delete objects.
+const gcsTokenScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// gcsServiceAccount is the subset of a GCP service account key file this
+// controller needs to mint an OAuth2 access token.
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// gcsConfig is the credentials and location a gcsBucketLister or
+// gcsBucketDeleter needs to talk to a bucket's GCS API.
+type gcsConfig struct {
+	ServiceAccount gcsServiceAccount
+	Bucket         string
+	// Endpoint overrides the default GCS JSON API endpoint. Used by tests.
+	Endpoint string
+}
+
+// gcsConfigFromSecret reads a gcsConfig out of a Bucket claim's connection
+// secret.
+func gcsConfigFromSecret(secret *corev1.Secret) (*gcsConfig, error) {
+	raw, ok := secret.Data[keyGCPServiceAccount]
+	if !ok {
+		return nil, errors.Errorf(errorFmtMissingSecretKey, keyGCPServiceAccount)
+	}
+	bucket, ok := secret.Data[keyGCPBucketName]
+	if !ok {
+		return nil, errors.Errorf(errorFmtMissingSecretKey, keyGCPBucketName)
+	}
+
+	sa := gcsServiceAccount{}
+	if err := json.Unmarshal(raw, &sa); err != nil {
+		return nil, errors.Wrap(err, "failed to parse gcp service account")
+	}
+
+	return &gcsConfig{ServiceAccount: sa, Bucket: string(bucket)}, nil
+}
+
+// endpoint returns the GCS JSON API endpoint this config talks to,
+// defaulting to the real GCS endpoint when Endpoint is not set.
+func (cfg *gcsConfig) endpoint() string {
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	return gcsDefaultEndpoint
+}
+
+// gcsAccessTokenResponse is the body of a Google OAuth2 token response.
+type gcsAccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+// gcsAccessToken mints an OAuth2 access token for cfg's service account
+// using the JWT bearer grant, per Google's server-to-server OAuth2 flow.
+func gcsAccessToken(ctx context.Context, cfg *gcsConfig) (string, error) {
+	block, _ := pem.Decode([]byte(cfg.ServiceAccount.PrivateKey))
+	if block == nil {
+		return "", errors.New("failed to decode gcp service account private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse gcp service account private key")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("gcp service account private key is not an RSA key")
+	}
+
+	tokenURI := cfg.ServiceAccount.TokenURI
+	if tokenURI == "" {
+		tokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   cfg.ServiceAccount.ClientEmail,
+		"scope": gcsTokenScope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	sum := sha256.Sum256([]byte(payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign gcp service account jwt")
+	}
+	assertion := payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequest(http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := doGCSRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	token := &gcsAccessTokenResponse{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// gcsObject is a single object entry in a GCS Objects.list response.
+type gcsObject struct {
+	Name       string `json:"name"`
+	ETag       string `json:"etag"`
+	Size       string `json:"size"`
+	Updated    string `json:"updated"`
+	TimeCreate string `json:"timeCreated"`
+}
+
+// gcsListObjectsResponse is a GCS Objects.list response.
+type gcsListObjectsResponse struct {
+	Items         []gcsObject `json:"items"`
+	NextPageToken string      `json:"nextPageToken"`
+}
+
+// gcsListObjects lists every object under prefix in cfg's bucket, following
+// page tokens until the listing is exhausted.
+func gcsListObjects(ctx context.Context, cfg *gcsConfig, prefix string) ([]bucketObject, error) {
+	token, err := gcsAccessToken(ctx, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to obtain gcs access token")
+	}
+
+	var objects []bucketObject
+	pageToken := ""
+	for {
+		query := url.Values{}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		u := fmt.Sprintf("%s/b/%s/o?%s", cfg.endpoint(), url.PathEscape(cfg.Bucket), query.Encode())
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		body, err := doGCSRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &gcsListObjectsResponse{}
+		if err := json.Unmarshal(body, result); err != nil {
+			return nil, err
+		}
+
+		for _, o := range result.Items {
+			size, err := strconv.ParseInt(o.Size, 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse size of object %q", o.Name)
+			}
+			updated, err := time.Parse(time.RFC3339, o.Updated)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse updated time of object %q", o.Name)
+			}
+			objects = append(objects, bucketObject{
+				Key:          o.Name,
+				ETag:         o.ETag,
+				Size:         size,
+				LastModified: updated,
+			})
+		}
+
+		if result.NextPageToken == "" {
+			return objects, nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
+
+// gcsDeleteObjects deletes the objects with the given keys from cfg's
+// bucket, calling GCS's Objects.delete once per key since the JSON API has
+// no batch delete endpoint.
+func gcsDeleteObjects(ctx context.Context, cfg *gcsConfig, keys []string) error {
+	token, err := gcsAccessToken(ctx, cfg)
+	if err != nil {
+		return errors.Wrap(err, "failed to obtain gcs access token")
+	}
+
+	for _, key := range keys {
+		u := fmt.Sprintf("%s/b/%s/o/%s", cfg.endpoint(), url.PathEscape(cfg.Bucket), url.PathEscape(key))
+		req, err := http.NewRequest(http.MethodDelete, u, nil)
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		if _, err := doGCSRequest(req); err != nil {
+			return errors.Wrapf(err, "failed to delete object %q", key)
+		}
+	}
+	return nil
+}
+
+// doGCSRequest executes req and returns its response body, erroring out if
+// the request itself fails or GCS responds with a non-200 status.
+func doGCSRequest(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("gcs request failed with status %s: %s", resp.Status, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitlab reconciles the GitLab custom resource into the set of
+// Crossplane resource claims and Helm values required to stand up a GitLab
+// Helm release.
+package gitlab
+
+import (
+	"context"
+
+	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplaneio/gitlab-controller/pkg/apis/controller/v1alpha1"
+)
+
+const (
+	errorFmtFailedToFindResourceClass          = "failed to find resource class for %s, provider: %s"
+	errorFmtFailedToCreate                     = "failed to create %s: %s"
+	errorFmtFailedToRetrieveInstance           = "failed to retrieve %s: %s"
+	errorResourceStatusIsNotFound              = "resource claim status is not found"
+	errorFmtFailedToRetrieveConnectionSecret   = "failed to retrieve connection secret: %s"
+	errorFmtFailedToUpdateConnectionSecretData = "failed to update connection secret data: %s"
+	errorFmtFailedToUpdateConnectionSecret     = "failed to update connection secret: %s"
+	errorFmtFailedToUpdateOwnerReferences      = "failed to update owner references of %s"
+)
+
+// A resourceReconciler reconciles a single Crossplane resource claim on
+// behalf of a GitLab resource, e.g. a storage Bucket.
+type resourceReconciler interface {
+	reconcile(ctx context.Context) error
+}
+
+// A resourceClassFinder finds the resource class that should be used to
+// satisfy a claim for the given resource kind from the given provider.
+type resourceClassFinder interface {
+	find(ctx context.Context, provider corev1.ObjectReference, resource string) (*corev1.ObjectReference, error)
+}
+
+// baseResourceReconciler holds the state shared by every resourceReconciler:
+// the GitLab resource being reconciled, the client used to talk to the API
+// server, the logical name of the child resource, and (once known) its
+// Crossplane resource claim status.
+type baseResourceReconciler struct {
+	GitLab *v1alpha1.GitLab
+	client client.Client
+	name   string
+
+	resourceClassFinder resourceClassFinder
+	status              *xpcorev1alpha1.ResourceClaimStatus
+}
+
+// newBaseResourceReconciler returns a baseResourceReconciler for the named
+// child resource of the supplied GitLab resource.
+func newBaseResourceReconciler(gitlab *v1alpha1.GitLab, c client.Client, name string) *baseResourceReconciler {
+	return &baseResourceReconciler{
+		GitLab: gitlab,
+		client: c,
+		name:   name,
+	}
+}
+
+// defaultResourceClassFinder is the default resourceClassFinder. It does not
+// look up any resource class: find always returns a nil reference and no
+// error, so claims are created without a class reference.
+type defaultResourceClassFinder struct {
+	client client.Client
+}
+
+func (f *defaultResourceClassFinder) find(ctx context.Context, provider corev1.ObjectReference, resource string) (*corev1.ObjectReference, error) {
+	return nil, nil
+}
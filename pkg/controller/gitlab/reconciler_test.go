@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+
+	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/helm/pkg/chartutil"
+
+	"github.com/crossplaneio/gitlab-controller/pkg/apis/controller/v1alpha1"
+)
+
+const (
+	testNamespace = "test-namespace"
+	testName      = "test-gitlab"
+)
+
+var (
+	testKey  = types.NamespacedName{Namespace: testNamespace, Name: testName}
+	testMeta = metav1.ObjectMeta{Namespace: testNamespace, Name: testName}
+
+	// cmpErrors compares two errors by message, treating nil as only equal
+	// to nil so test cases can assert both "no error" and specific wrapped
+	// error chains.
+	cmpErrors = cmp.Comparer(func(x, y error) bool {
+		if x == nil || y == nil {
+			return x == y
+		}
+		return x.Error() == y.Error()
+	})
+)
+
+type gitLabBuilder struct {
+	gitlab *v1alpha1.GitLab
+}
+
+func newGitLabBuilder() *gitLabBuilder {
+	return &gitLabBuilder{gitlab: &v1alpha1.GitLab{}}
+}
+
+func (b *gitLabBuilder) withMeta(meta metav1.ObjectMeta) *gitLabBuilder {
+	b.gitlab.ObjectMeta = meta
+	return b
+}
+
+func (b *gitLabBuilder) withBuckets(buckets ...v1alpha1.BucketSpec) *gitLabBuilder {
+	b.gitlab.Spec.Buckets = buckets
+	return b
+}
+
+func (b *gitLabBuilder) withDeletionTimestamp(t metav1.Time) *gitLabBuilder {
+	b.gitlab.ObjectMeta.DeletionTimestamp = &t
+	return b
+}
+
+func (b *gitLabBuilder) withProviderRef(ref corev1.ObjectReference) *gitLabBuilder {
+	b.gitlab.Spec.ProviderRef = ref
+	return b
+}
+
+func (b *gitLabBuilder) build() *v1alpha1.GitLab {
+	return b.gitlab
+}
+
+type mockResourceClassFinder struct {
+	mockFind func(ctx context.Context, provider corev1.ObjectReference, resource string) (*corev1.ObjectReference, error)
+}
+
+func (m *mockResourceClassFinder) find(ctx context.Context, provider corev1.ObjectReference, resource string) (*corev1.ObjectReference, error) {
+	return m.mockFind(ctx, provider, resource)
+}
+
+type resourceClaimStatusBuilder struct {
+	status *xpcorev1alpha1.ResourceClaimStatus
+}
+
+func newResourceClaimStatusBuilder() *resourceClaimStatusBuilder {
+	return &resourceClaimStatusBuilder{status: &xpcorev1alpha1.ResourceClaimStatus{}}
+}
+
+func (b *resourceClaimStatusBuilder) withCreatingStatus() *resourceClaimStatusBuilder {
+	b.status.Conditions = []xpcorev1alpha1.Condition{
+		{Type: xpcorev1alpha1.Creating, Status: corev1.ConditionTrue},
+	}
+	return b
+}
+
+func (b *resourceClaimStatusBuilder) withReadyStatus() *resourceClaimStatusBuilder {
+	b.status.Conditions = []xpcorev1alpha1.Condition{
+		{Type: xpcorev1alpha1.Ready, Status: corev1.ConditionTrue},
+	}
+	return b
+}
+
+func (b *resourceClaimStatusBuilder) withCredentialsSecretRef(name string) *resourceClaimStatusBuilder {
+	b.status.CredentialsSecretRef = corev1.LocalObjectReference{Name: name}
+	return b
+}
+
+func (b *resourceClaimStatusBuilder) build() *xpcorev1alpha1.ResourceClaimStatus {
+	return b.status
+}
+
+// newMockHelmValuesFn composes a bucketValuesFn out of the supplied
+// functions, applying each in turn, so test cases can stub
+// bucketReconciler.getHelmValues without depending on the real Helm values
+// functions.
+func newMockHelmValuesFn(fns []bucketValuesFn) bucketValuesFn {
+	return func(values chartutil.Values, secret *corev1.Secret, name, secretPrefix string) chartutil.Values {
+		for _, fn := range fns {
+			values = fn(values, secret, name, secretPrefix)
+		}
+		return values
+	}
+}
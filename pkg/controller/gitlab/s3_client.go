@@ -0,0 +1,407 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Connection secret keys an s3Config is read from, alongside the AWS
+// credential keys an s3SecretUpdater already expects to find there.
+const (
+	keyAWSBucketName = "AWS_BUCKET_NAME"
+	keyAWSRegion     = "AWS_REGION"
+	// keyAWSS3Endpoint overrides the default regional AWS endpoint, e.g. to
+	// point at an S3-compatible store. Optional.
+	keyAWSS3Endpoint = "AWS_S3_ENDPOINT"
+)
+
+// s3MaxDeleteBatch is the largest number of keys a single S3 multi-object
+// delete request may carry.
+const s3MaxDeleteBatch = 1000
+
+// s3Config is the credentials and location an s3BucketLister or
+// s3BucketDeleter needs to talk to a bucket's S3 API.
+type s3Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Bucket          string
+	Region          string
+	Endpoint        string
+}
+
+// s3ConfigFromSecret reads an s3Config out of a Bucket claim's connection
+// secret.
+func s3ConfigFromSecret(secret *corev1.Secret) (*s3Config, error) {
+	accessKey, ok := secret.Data[keyAWSAccessKeyID]
+	if !ok {
+		return nil, errors.Errorf(errorFmtMissingSecretKey, keyAWSAccessKeyID)
+	}
+	secretKey, ok := secret.Data[keyAWSSecretAccessKey]
+	if !ok {
+		return nil, errors.Errorf(errorFmtMissingSecretKey, keyAWSSecretAccessKey)
+	}
+	bucket, ok := secret.Data[keyAWSBucketName]
+	if !ok {
+		return nil, errors.Errorf(errorFmtMissingSecretKey, keyAWSBucketName)
+	}
+	region, ok := secret.Data[keyAWSRegion]
+	if !ok {
+		return nil, errors.Errorf(errorFmtMissingSecretKey, keyAWSRegion)
+	}
+
+	return &s3Config{
+		AccessKeyID:     string(accessKey),
+		SecretAccessKey: string(secretKey),
+		Bucket:          string(bucket),
+		Region:          string(region),
+		Endpoint:        string(secret.Data[keyAWSS3Endpoint]),
+	}, nil
+}
+
+// endpoint returns the S3 endpoint this config talks to, defaulting to the
+// regional AWS endpoint when Endpoint is not set.
+func (cfg *s3Config) endpoint() string {
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	return fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+}
+
+// bucketURL returns the path-style URL for this config's bucket with the
+// given (already encoded) raw query string.
+func (cfg *s3Config) bucketURL(rawQuery string) (*url.URL, error) {
+	u, err := url.Parse(cfg.endpoint())
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + cfg.Bucket
+	u.RawQuery = rawQuery
+	return u, nil
+}
+
+// s3Object is a single <Contents> entry in an S3 ListObjectsV2 response.
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// s3ListBucketResult is an S3 ListObjectsV2 response.
+type s3ListBucketResult struct {
+	XMLName               xml.Name   `xml:"ListBucketResult"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+	Contents              []s3Object `xml:"Contents"`
+}
+
+// s3ListObjects lists every object under prefix in cfg's bucket, following
+// continuation tokens until the listing is exhausted.
+func s3ListObjects(ctx context.Context, cfg *s3Config, prefix string) ([]bucketObject, error) {
+	var objects []bucketObject
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		u, err := cfg.bucketURL(query.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		signS3Request(req, cfg, sha256Hex(nil), time.Now())
+
+		body, err := doS3Request(req)
+		if err != nil {
+			return nil, err
+		}
+		result := &s3ListBucketResult{}
+		if err := xml.Unmarshal(body, result); err != nil {
+			return nil, err
+		}
+
+		for _, o := range result.Contents {
+			objects = append(objects, bucketObject{
+				Key:          o.Key,
+				ETag:         strings.Trim(o.ETag, `"`),
+				Size:         o.Size,
+				LastModified: o.LastModified,
+			})
+		}
+
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// s3DeleteObject is a single <Object> entry in an S3 multi-object delete
+// request.
+type s3DeleteObject struct {
+	Key string `xml:"Key"`
+}
+
+// s3DeleteRequest is an S3 multi-object delete request body.
+type s3DeleteRequest struct {
+	XMLName xml.Name         `xml:"Delete"`
+	Objects []s3DeleteObject `xml:"Object"`
+}
+
+// s3DeleteError is a single <Error> entry in an S3 multi-object delete
+// response, reported for a key S3 failed to delete.
+type s3DeleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3DeleteResult is an S3 multi-object delete response.
+type s3DeleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Errors  []s3DeleteError `xml:"Error"`
+}
+
+// s3DeleteObjects deletes the objects with the given keys from cfg's bucket,
+// batching requests to stay within S3's per-request object limit.
+func s3DeleteObjects(ctx context.Context, cfg *s3Config, keys []string) error {
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > s3MaxDeleteBatch {
+			batch = batch[:s3MaxDeleteBatch]
+		}
+		keys = keys[len(batch):]
+
+		del := s3DeleteRequest{}
+		for _, k := range batch {
+			del.Objects = append(del.Objects, s3DeleteObject{Key: k})
+		}
+		body, err := xml.Marshal(del)
+		if err != nil {
+			return err
+		}
+
+		u, err := cfg.bucketURL("delete=")
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		req.ContentLength = int64(len(body))
+		sum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		req.Header.Set("Content-Type", "application/xml")
+		signS3Request(req, cfg, sha256Hex(body), time.Now())
+
+		body, err = doS3Request(req)
+		if err != nil {
+			return err
+		}
+		result := &s3DeleteResult{}
+		if err := xml.Unmarshal(body, result); err != nil {
+			return err
+		}
+		if len(result.Errors) > 0 {
+			msgs := make([]string, len(result.Errors))
+			for i, e := range result.Errors {
+				msgs[i] = fmt.Sprintf("%s: %s (%s)", e.Key, e.Message, e.Code)
+			}
+			return errors.Errorf("failed to delete %d object(s): %s", len(result.Errors), strings.Join(msgs, "; "))
+		}
+	}
+	return nil
+}
+
+// doS3Request executes req and returns its response body, erroring out if
+// the request itself fails or S3 responds with a non-200 status.
+func doS3Request(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("s3 request failed with status %s: %s", resp.Status, body)
+	}
+	return body, nil
+}
+
+// signS3Request signs req for cfg's bucket using AWS Signature Version 4,
+// setting its X-Amz-Date, X-Amz-Content-Sha256, and Authorization headers.
+func signS3Request(req *http.Request, cfg *s3Config, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	dateStamp := now.UTC().Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalHeaders, signedHeaders := canonicalS3Headers(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.EscapedPath()),
+		canonicalQueryString(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	credentialScope := fmt.Sprintf("%s/%s/s3/aws4_request", dateStamp, cfg.Region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		credentialScope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(s3SigningKey(cfg.SecretAccessKey, dateStamp, cfg.Region), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.AccessKeyID, credentialScope, signedHeaders, signature,
+	))
+}
+
+// canonicalS3Headers returns the canonical headers block and signed headers
+// list for a SigV4 canonical request, per the AWS documentation.
+func canonicalS3Headers(req *http.Request) (canonical, signed string) {
+	type header struct{ name, value string }
+	headers := []header{{"host", req.URL.Host}}
+	if v := req.Header.Get("Content-MD5"); v != "" {
+		headers = append(headers, header{"content-md5", v})
+	}
+	headers = append(headers,
+		header{"x-amz-content-sha256", req.Header.Get("X-Amz-Content-Sha256")},
+		header{"x-amz-date", req.Header.Get("X-Amz-Date")},
+	)
+	sort.Slice(headers, func(i, j int) bool { return headers[i].name < headers[j].name })
+
+	var b strings.Builder
+	names := make([]string, len(headers))
+	for i, h := range headers {
+		fmt.Fprintf(&b, "%s:%s\n", h.name, strings.TrimSpace(h.value))
+		names[i] = h.name
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+// canonicalURI returns the SigV4 canonical form of an S3 request path.
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = awsURIEncode(s, false)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQueryString returns the SigV4 canonical form of an S3 request's
+// query string: parameters sorted by key, then by value, with both
+// URI-encoded per AWS's (non-RFC-3986) rules.
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes s per the rules SigV4 requires for canonical
+// requests, which differ slightly from net/url's: every octet outside
+// A-Za-z0-9-_.~ is escaped, including '/' unless encodeSlash is false.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// sha256Hex returns the lowercase hex-encoded SHA-256 digest of b.
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data using key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3SigningKey derives the SigV4 signing key for secretKey, dateStamp, and
+// region, scoped to the S3 service.
+func s3SigningKey(secretKey, dateStamp, region string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	kRegion := hmacSHA256(kDate, region)
+	kService := hmacSHA256(kRegion, "s3")
+	return hmacSHA256(kService, "aws4_request")
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_s3ConfigFromSecret(t *testing.T) {
+	cases := map[string]struct {
+		secret  *corev1.Secret
+		want    *s3Config
+		wantErr error
+	}{
+		"MissingAccessKeyID": {
+			secret:  &corev1.Secret{Data: map[string][]byte{}},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyAWSAccessKeyID),
+		},
+		"MissingBucketName": {
+			secret: &corev1.Secret{Data: map[string][]byte{
+				keyAWSAccessKeyID:     []byte("id"),
+				keyAWSSecretAccessKey: []byte("secret"),
+			}},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyAWSBucketName),
+		},
+		"Successful": {
+			secret: &corev1.Secret{Data: map[string][]byte{
+				keyAWSAccessKeyID:     []byte("id"),
+				keyAWSSecretAccessKey: []byte("secret"),
+				keyAWSBucketName:      []byte("my-bucket"),
+				keyAWSRegion:          []byte("us-east-1"),
+			}},
+			want: &s3Config{AccessKeyID: "id", SecretAccessKey: "secret", Bucket: "my-bucket", Region: "us-east-1"},
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := s3ConfigFromSecret(tt.secret)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("s3ConfigFromSecret() error %s", diff)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("s3ConfigFromSecret() -got, +want: %s", diff)
+			}
+		})
+	}
+}
+
+func Test_canonicalQueryString(t *testing.T) {
+	cases := map[string]struct {
+		query url.Values
+		want  string
+	}{
+		"Empty": {
+			query: url.Values{},
+			want:  "",
+		},
+		"SortedByKeyThenValue": {
+			query: url.Values{"b": {"2"}, "a": {"2", "1"}},
+			want:  "a=1&a=2&b=2",
+		},
+		"SpaceEncodedAsPercent20": {
+			query: url.Values{"prefix": {"backups/a b"}},
+			want:  "prefix=backups%2Fa%20b",
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(canonicalQueryString(tt.query), tt.want); diff != "" {
+				t.Errorf("canonicalQueryString() -got, +want: %s", diff)
+			}
+		})
+	}
+}
+
+func Test_s3ListObjects(t *testing.T) {
+	ctx := context.TODO()
+	oldest := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	newest := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+			http.Error(w, "missing or malformed Authorization header", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("prefix") != bucketBackupsPrefix {
+			http.Error(w, "missing expected prefix", http.StatusBadRequest)
+			return
+		}
+
+		result := s3ListBucketResult{}
+		if r.URL.Query().Get("continuation-token") == "" {
+			result.IsTruncated = true
+			result.NextContinuationToken = "page-2"
+			result.Contents = []s3Object{
+				{Key: "backups/old", ETag: `"a"`, Size: 1, LastModified: oldest},
+			}
+		} else {
+			result.Contents = []s3Object{
+				{Key: "backups/new", ETag: `"b"`, Size: 2, LastModified: newest},
+			}
+		}
+
+		body, err := xml.Marshal(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	cfg := &s3Config{AccessKeyID: "test-key", SecretAccessKey: "test-secret", Bucket: "test-bucket", Region: "us-east-1", Endpoint: srv.URL}
+
+	got, err := s3ListObjects(ctx, cfg, bucketBackupsPrefix)
+	if err != nil {
+		t.Fatalf("s3ListObjects() error = %s", err)
+	}
+	want := []bucketObject{
+		{Key: "backups/old", ETag: "a", Size: 1, LastModified: oldest},
+		{Key: "backups/new", ETag: "b", Size: 2, LastModified: newest},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("s3ListObjects() -got, +want: %s", diff)
+	}
+	if requests != 2 {
+		t.Errorf("s3ListObjects() made %d requests, want 2 (one per page)", requests)
+	}
+}
+
+func Test_s3DeleteObjects(t *testing.T) {
+	ctx := context.TODO()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+			http.Error(w, "missing or malformed Authorization header", http.StatusBadRequest)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var del s3DeleteRequest
+		if err := xml.Unmarshal(body, &del); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := s3DeleteResult{}
+		for _, o := range del.Objects {
+			if o.Key == "backups/fails" {
+				result.Errors = append(result.Errors, s3DeleteError{Key: o.Key, Code: "AccessDenied", Message: "denied"})
+			}
+		}
+		out, err := xml.Marshal(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(out)
+	}))
+	defer srv.Close()
+
+	cfg := &s3Config{AccessKeyID: "test-key", SecretAccessKey: "test-secret", Bucket: "test-bucket", Region: "us-east-1", Endpoint: srv.URL}
+
+	if err := s3DeleteObjects(ctx, cfg, []string{"backups/old", "backups/new"}); err != nil {
+		t.Errorf("s3DeleteObjects() error = %s, want nil", err)
+	}
+
+	err := s3DeleteObjects(ctx, cfg, []string{"backups/fails"})
+	if err == nil {
+		t.Error("s3DeleteObjects() error = nil, want an error reporting the failed key")
+	} else if !strings.Contains(err.Error(), "backups/fails") {
+		t.Errorf("s3DeleteObjects() error = %s, want it to mention the failed key", err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Provider keys used to select a secretUpdater, bucketLister, or
+// bucketDeleter, and to stamp the Helm "provider" value the GitLab chart
+// uses to pick a backend driver.
+const (
+	providerS3    = "s3"
+	providerGCS   = "gcs"
+	providerAzure = "azure"
+)
+
+const (
+	keyAWSAccessKeyID      = "AWS_ACCESS_KEY_ID"
+	keyAWSSecretAccessKey  = "AWS_SECRET_ACCESS_KEY"
+	keyGCPServiceAccount   = "serviceaccount.json"
+	keyAzureStorageAccount = "AZURE_STORAGE_ACCOUNT_NAME"
+	keyAzureStorageKey     = "AZURE_STORAGE_ACCOUNT_KEY"
+)
+
+const errorFmtMissingSecretKey = "connection secret is missing required key %q"
+
+// providerKeyFromRef maps a Crossplane provider's object reference to the
+// provider key used to select a secretUpdater, bucketLister, or
+// bucketDeleter. A zero-value reference (no provider kind set) defaults to
+// S3, so that single-provider deployments that don't set an explicit
+// provider kind keep working unchanged. Any other, unrecognized kind is
+// passed through unchanged so that it fails to match an entry in
+// defaultSecretUpdaters/defaultBucketListers/defaultBucketDeleters and
+// surfaces errorFmtNotSupportedProvider, rather than being silently treated
+// as S3.
+func providerKeyFromRef(ref corev1.ObjectReference) string {
+	switch ref.Kind {
+	case "":
+		return providerS3
+	case "AWSProvider":
+		return providerS3
+	case "GCPProvider":
+		return providerGCS
+	case "AzureProvider":
+		return providerAzure
+	default:
+		return ref.Kind
+	}
+}
+
+// defaultSecretUpdaters returns the secretUpdater registered for every
+// provider this controller knows how to transform connection secrets for.
+func defaultSecretUpdaters() map[string]secretUpdater {
+	return map[string]secretUpdater{
+		providerS3:    &s3SecretUpdater{},
+		providerGCS:   &gcsSecretUpdater{},
+		providerAzure: &azureBlobSecretUpdater{},
+	}
+}
+
+// s3SecretUpdater rewrites an S3 Bucket claim's connection secret into the
+// s3cfg-shaped connection blob the GitLab chart expects.
+type s3SecretUpdater struct{}
+
+func (u *s3SecretUpdater) update(secret *corev1.Secret) error {
+	accessKey, ok := secret.Data[keyAWSAccessKeyID]
+	if !ok {
+		return errors.Errorf(errorFmtMissingSecretKey, keyAWSAccessKeyID)
+	}
+	secretKey, ok := secret.Data[keyAWSSecretAccessKey]
+	if !ok {
+		return errors.Errorf(errorFmtMissingSecretKey, keyAWSSecretAccessKey)
+	}
+
+	s3cfg := fmt.Sprintf("[default]\naccess_key = %s\nsecret_key = %s\n", accessKey, secretKey)
+	secret.Data[connectionKey] = []byte(s3cfg)
+	return nil
+}
+
+// gcsSecretUpdater rewrites a GCS Bucket claim's connection secret into the
+// service account JSON blob the GitLab chart expects.
+type gcsSecretUpdater struct{}
+
+func (u *gcsSecretUpdater) update(secret *corev1.Secret) error {
+	serviceAccount, ok := secret.Data[keyGCPServiceAccount]
+	if !ok {
+		return errors.Errorf(errorFmtMissingSecretKey, keyGCPServiceAccount)
+	}
+
+	secret.Data[connectionKey] = serviceAccount
+	return nil
+}
+
+// azureBlobSecretUpdater rewrites an Azure Blob Bucket claim's connection
+// secret into the azure_storage_* keys the GitLab chart expects.
+type azureBlobSecretUpdater struct{}
+
+func (u *azureBlobSecretUpdater) update(secret *corev1.Secret) error {
+	account, ok := secret.Data[keyAzureStorageAccount]
+	if !ok {
+		return errors.Errorf(errorFmtMissingSecretKey, keyAzureStorageAccount)
+	}
+	key, ok := secret.Data[keyAzureStorageKey]
+	if !ok {
+		return errors.Errorf(errorFmtMissingSecretKey, keyAzureStorageKey)
+	}
+
+	azureCfg := fmt.Sprintf("azure_storage_account_name = %s\nazure_storage_account_key = %s\n", account, key)
+	secret.Data[connectionKey] = []byte(azureCfg)
+	return nil
+}
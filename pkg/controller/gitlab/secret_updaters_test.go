@@ -0,0 +1,159 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_providerKeyFromRef(t *testing.T) {
+	cases := map[string]struct {
+		ref  corev1.ObjectReference
+		want string
+	}{
+		"ZeroValue":        {ref: corev1.ObjectReference{}, want: providerS3},
+		"AWSProvider":      {ref: corev1.ObjectReference{Kind: "AWSProvider"}, want: providerS3},
+		"GCPProvider":      {ref: corev1.ObjectReference{Kind: "GCPProvider"}, want: providerGCS},
+		"AzureProvider":    {ref: corev1.ObjectReference{Kind: "AzureProvider"}, want: providerAzure},
+		"UnrecognizedKind": {ref: corev1.ObjectReference{Kind: "SomeOtherProvider"}, want: "SomeOtherProvider"},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := providerKeyFromRef(tt.ref)
+			if got != tt.want {
+				t.Errorf("providerKeyFromRef() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_s3SecretUpdater_update(t *testing.T) {
+	cases := map[string]struct {
+		secret  *corev1.Secret
+		want    []byte
+		wantErr error
+	}{
+		"MissingAccessKeyID": {
+			secret:  &corev1.Secret{Data: map[string][]byte{}},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyAWSAccessKeyID),
+		},
+		"MissingSecretAccessKey": {
+			secret: &corev1.Secret{Data: map[string][]byte{
+				keyAWSAccessKeyID: []byte("id"),
+			}},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyAWSSecretAccessKey),
+		},
+		"Successful": {
+			secret: &corev1.Secret{Data: map[string][]byte{
+				keyAWSAccessKeyID:     []byte("id"),
+				keyAWSSecretAccessKey: []byte("secret"),
+			}},
+			want: []byte("[default]\naccess_key = id\nsecret_key = secret\n"),
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			u := &s3SecretUpdater{}
+			err := u.update(tt.secret)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("s3SecretUpdater.update() error %s", diff)
+			}
+			if tt.wantErr == nil {
+				if diff := cmp.Diff(tt.secret.Data[connectionKey], tt.want); diff != "" {
+					t.Errorf("s3SecretUpdater.update() -got, +want: %s", diff)
+				}
+			}
+		})
+	}
+}
+
+func Test_gcsSecretUpdater_update(t *testing.T) {
+	cases := map[string]struct {
+		secret  *corev1.Secret
+		want    []byte
+		wantErr error
+	}{
+		"MissingServiceAccount": {
+			secret:  &corev1.Secret{Data: map[string][]byte{}},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyGCPServiceAccount),
+		},
+		"Successful": {
+			secret: &corev1.Secret{Data: map[string][]byte{
+				keyGCPServiceAccount: []byte(`{"client_email":"test@test.iam.gserviceaccount.com"}`),
+			}},
+			want: []byte(`{"client_email":"test@test.iam.gserviceaccount.com"}`),
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			u := &gcsSecretUpdater{}
+			err := u.update(tt.secret)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("gcsSecretUpdater.update() error %s", diff)
+			}
+			if tt.wantErr == nil {
+				if diff := cmp.Diff(tt.secret.Data[connectionKey], tt.want); diff != "" {
+					t.Errorf("gcsSecretUpdater.update() -got, +want: %s", diff)
+				}
+			}
+		})
+	}
+}
+
+func Test_azureBlobSecretUpdater_update(t *testing.T) {
+	cases := map[string]struct {
+		secret  *corev1.Secret
+		want    []byte
+		wantErr error
+	}{
+		"MissingAccountName": {
+			secret:  &corev1.Secret{Data: map[string][]byte{}},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyAzureStorageAccount),
+		},
+		"MissingAccountKey": {
+			secret: &corev1.Secret{Data: map[string][]byte{
+				keyAzureStorageAccount: []byte("account"),
+			}},
+			wantErr: errors.Errorf(errorFmtMissingSecretKey, keyAzureStorageKey),
+		},
+		"Successful": {
+			secret: &corev1.Secret{Data: map[string][]byte{
+				keyAzureStorageAccount: []byte("account"),
+				keyAzureStorageKey:     []byte("key"),
+			}},
+			want: []byte("azure_storage_account_name = account\nazure_storage_account_key = key\n"),
+		},
+	}
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			u := &azureBlobSecretUpdater{}
+			err := u.update(tt.secret)
+			if diff := cmp.Diff(err, tt.wantErr, cmpErrors); diff != "" {
+				t.Errorf("azureBlobSecretUpdater.update() error %s", diff)
+			}
+			if tt.wantErr == nil {
+				if diff := cmp.Diff(tt.secret.Data[connectionKey], tt.want); diff != "" {
+					t.Errorf("azureBlobSecretUpdater.update() -got, +want: %s", diff)
+				}
+			}
+		})
+	}
+}
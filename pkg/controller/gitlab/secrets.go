@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// connectionKey is the key under which a bucket's rewritten, chart-shaped
+// connection blob is stored in its connection secret.
+const connectionKey = "connection"
+
+const errorFmtNotSupportedProvider = "provider %q is not supported"
+
+// A secretTransformer rewrites a resource claim's connection secret into the
+// shape the GitLab Helm chart expects.
+type secretTransformer interface {
+	transform(ctx context.Context) error
+}
+
+// A secretUpdater mutates a connection secret in place, translating its
+// provider-specific credential keys into the canonical shape consumed by
+// bucketConnectionHelmValues and bucketBackupsHelmValues.
+type secretUpdater interface {
+	update(secret *corev1.Secret) error
+}
+
+// gitLabSecretTransformer is the default secretTransformer. It fetches a
+// resource claim's connection secret and hands it to the secretUpdater
+// registered for the claim's provider.
+type gitLabSecretTransformer struct {
+	*baseResourceReconciler
+
+	secretUpdaters   map[string]secretUpdater
+	credentialSource credentialSource
+}
+
+// newGitLabSecretTransformer returns a gitLabSecretTransformer configured
+// with the default, built-in secretUpdaters and the supplied credentialSource.
+func newGitLabSecretTransformer(base *baseResourceReconciler, source credentialSource) *gitLabSecretTransformer {
+	return &gitLabSecretTransformer{
+		baseResourceReconciler: base,
+		secretUpdaters:         defaultSecretUpdaters(),
+		credentialSource:       source,
+	}
+}
+
+// provider returns the key under which this transformer looks up its
+// secretUpdater, derived from the GitLab resource's provider reference.
+func (tr *gitLabSecretTransformer) provider() string {
+	return providerKeyFromRef(tr.GitLab.GetProviderRef())
+}
+
+// transform fetches the claim's connection secret, rewrites it via the
+// secretUpdater registered for the claim's provider, and persists the
+// result.
+func (tr *gitLabSecretTransformer) transform(ctx context.Context) error {
+	if tr.status == nil {
+		return errors.New(errorResourceStatusIsNotFound)
+	}
+
+	secretKey := types.NamespacedName{Namespace: tr.GitLab.GetNamespace(), Name: tr.status.CredentialsSecretRef.Name}
+
+	source := tr.credentialSource
+	if source == nil {
+		source = &secretCredentialSource{client: tr.client}
+	}
+	secret, err := source.Fetch(ctx, secretKey)
+	if err != nil {
+		return err
+	}
+
+	updater, ok := tr.secretUpdaters[tr.provider()]
+	if !ok {
+		return errors.Errorf(errorFmtNotSupportedProvider, tr.provider())
+	}
+
+	if err := updater.update(secret); err != nil {
+		return errors.Wrapf(err, errorFmtFailedToUpdateConnectionSecretData, secretKey)
+	}
+
+	if err := tr.client.Update(ctx, secret); err != nil {
+		return errors.Wrapf(err, errorFmtFailedToUpdateConnectionSecret, secretKey)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/helm/pkg/chartutil"
+)
+
+const (
+	valuesKeyGlobal    = "global"
+	valuesKeyAppConfig = "appConfig"
+	valuesKeyGitlab    = "gitlab"
+)
+
+// setValue walks (creating as necessary) the nested chartutil.Values maps
+// named by path and sets the final key to v.
+func setValue(values chartutil.Values, path []string, v interface{}) {
+	m := values
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(chartutil.Values)
+		if !ok {
+			next = chartutil.Values{}
+			m[key] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = v
+}
+
+// bucketConnectionHelmValues writes the Helm values a bucket's own chart
+// stanza needs to reach it directly, e.g. for GitLab's object storage
+// integrations.
+func bucketConnectionHelmValues(values chartutil.Values, secret *corev1.Secret, name, secretPrefix string) chartutil.Values {
+	endpoint := string(secret.Data[xpcorev1alpha1.ResourceCredentialsSecretEndpointKey])
+	setValue(values, []string{valuesKeyGlobal, valuesKeyAppConfig, name}, chartutil.Values{
+		"bucket": endpoint,
+		"connection": chartutil.Values{
+			"key":    connectionKey,
+			"secret": secretPrefix + secret.Name,
+		},
+	})
+	return values
+}
+
+// bucketBackupsHelmValues writes the Helm values that point the
+// task-runner's backup job at this bucket.
+func bucketBackupsHelmValues(values chartutil.Values, secret *corev1.Secret, name, secretPrefix string) chartutil.Values {
+	endpoint := string(secret.Data[xpcorev1alpha1.ResourceCredentialsSecretEndpointKey])
+	setValue(values, []string{valuesKeyGlobal, valuesKeyAppConfig, name}, chartutil.Values{
+		"bucket": endpoint,
+	})
+	setValue(values, []string{valuesKeyGitlab, "task-runner", "backups", "objectStorage", "config"}, chartutil.Values{
+		"key":    connectionKey,
+		"secret": secretPrefix + secret.Name,
+	})
+	return values
+}
+
+// bucketBackupsTempHelmValues writes the Helm value that tells the
+// task-runner which bucket to use for temporary backup archives.
+func bucketBackupsTempHelmValues(values chartutil.Values, secret *corev1.Secret, name, secretPrefix string) chartutil.Values {
+	setValue(values, []string{valuesKeyGlobal, valuesKeyAppConfig, "backups", "tmpBucket"}, name)
+	return values
+}
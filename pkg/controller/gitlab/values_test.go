@@ -0,0 +1,147 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"testing"
+
+	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/helm/pkg/chartutil"
+)
+
+func Test_setValue(t *testing.T) {
+	values := chartutil.Values{}
+	setValue(values, []string{"global", "appConfig", "bucket"}, "my-bucket")
+
+	want := chartutil.Values{
+		"global": chartutil.Values{
+			"appConfig": chartutil.Values{
+				"bucket": "my-bucket",
+			},
+		},
+	}
+	if diff := cmp.Diff(values, want); diff != "" {
+		t.Errorf("setValue() -got, +want: %s", diff)
+	}
+}
+
+func Test_setValue_PreservesExistingKeys(t *testing.T) {
+	values := chartutil.Values{
+		"global": chartutil.Values{
+			"appConfig": chartutil.Values{
+				"other": "value",
+			},
+		},
+	}
+	setValue(values, []string{"global", "appConfig", "bucket"}, "my-bucket")
+
+	want := chartutil.Values{
+		"global": chartutil.Values{
+			"appConfig": chartutil.Values{
+				"other":  "value",
+				"bucket": "my-bucket",
+			},
+		},
+	}
+	if diff := cmp.Diff(values, want); diff != "" {
+		t.Errorf("setValue() -got, +want: %s", diff)
+	}
+}
+
+func Test_bucketConnectionHelmValues_SetsConnection(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret"},
+		Data: map[string][]byte{
+			xpcorev1alpha1.ResourceCredentialsSecretEndpointKey: []byte("my-bucket.s3.amazonaws.com"),
+		},
+	}
+
+	got := bucketConnectionHelmValues(chartutil.Values{}, secret, "artifacts", "gitlab-")
+
+	want := chartutil.Values{
+		"global": chartutil.Values{
+			"appConfig": chartutil.Values{
+				"artifacts": chartutil.Values{
+					"bucket": "my-bucket.s3.amazonaws.com",
+					"connection": chartutil.Values{
+						"key":    connectionKey,
+						"secret": "gitlab-test-secret",
+					},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("bucketConnectionHelmValues() -got, +want: %s", diff)
+	}
+}
+
+func Test_bucketBackupsHelmValues_SetsBackupsConfig(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-secret"},
+		Data: map[string][]byte{
+			xpcorev1alpha1.ResourceCredentialsSecretEndpointKey: []byte("my-bucket.s3.amazonaws.com"),
+		},
+	}
+
+	got := bucketBackupsHelmValues(chartutil.Values{}, secret, "backups", "gitlab-")
+
+	want := chartutil.Values{
+		"global": chartutil.Values{
+			"appConfig": chartutil.Values{
+				"backups": chartutil.Values{
+					"bucket": "my-bucket.s3.amazonaws.com",
+				},
+			},
+		},
+		"gitlab": chartutil.Values{
+			"task-runner": chartutil.Values{
+				"backups": chartutil.Values{
+					"objectStorage": chartutil.Values{
+						"config": chartutil.Values{
+							"key":    connectionKey,
+							"secret": "gitlab-test-secret",
+						},
+					},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("bucketBackupsHelmValues() -got, +want: %s", diff)
+	}
+}
+
+func Test_bucketBackupsTempHelmValues_SetsTmpBucket(t *testing.T) {
+	got := bucketBackupsTempHelmValues(chartutil.Values{}, &corev1.Secret{}, "tmp", "gitlab-")
+
+	want := chartutil.Values{
+		"global": chartutil.Values{
+			"appConfig": chartutil.Values{
+				"backups": chartutil.Values{
+					"tmpBucket": "tmp",
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("bucketBackupsTempHelmValues() -got, +want: %s", diff)
+	}
+}
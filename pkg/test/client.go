@@ -0,0 +1,90 @@
+/*
+Copyright 2019 The GitLab-Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package test contains utilities for testing the GitLab controller.
+package test
+
+import (
+	"context"
+
+	xpcorev1alpha1 "github.com/crossplaneio/crossplane/pkg/apis/core/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MockClient is a mock implementation of client.Client that delegates to the
+// function fields set on it, allowing each test case to stub only the calls
+// it cares about.
+type MockClient struct {
+	MockGet    func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error
+	MockList   func(ctx context.Context, opts *client.ListOptions, list runtime.Object) error
+	MockCreate func(ctx context.Context, obj runtime.Object) error
+	MockDelete func(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error
+	MockUpdate func(ctx context.Context, obj runtime.Object) error
+}
+
+// NewMockClient returns a MockClient whose methods are all no-ops, suitable
+// as a base to override individual calls on.
+func NewMockClient() *MockClient {
+	return &MockClient{
+		MockGet:    func(ctx context.Context, key client.ObjectKey, obj runtime.Object) error { return nil },
+		MockList:   func(ctx context.Context, opts *client.ListOptions, list runtime.Object) error { return nil },
+		MockCreate: func(ctx context.Context, obj runtime.Object) error { return nil },
+		MockDelete: func(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error { return nil },
+		MockUpdate: func(ctx context.Context, obj runtime.Object) error { return nil },
+	}
+}
+
+// Get calls MockGet.
+func (c *MockClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return c.MockGet(ctx, key, obj)
+}
+
+// List calls MockList.
+func (c *MockClient) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	return c.MockList(ctx, opts, list)
+}
+
+// Create calls MockCreate.
+func (c *MockClient) Create(ctx context.Context, obj runtime.Object) error {
+	return c.MockCreate(ctx, obj)
+}
+
+// Delete calls MockDelete.
+func (c *MockClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error {
+	return c.MockDelete(ctx, obj, opts...)
+}
+
+// Update calls MockUpdate.
+func (c *MockClient) Update(ctx context.Context, obj runtime.Object) error {
+	return c.MockUpdate(ctx, obj)
+}
+
+// EqualConditionedStatus is a cmp.Comparer that treats two ResourceClaimStatus
+// values as equal when their conditions match, ignoring LastTransitionTime so
+// that tests do not become flaky on wall clock time.
+func EqualConditionedStatus(a, b xpcorev1alpha1.ResourceClaimStatus) bool {
+	if len(a.Conditions) != len(b.Conditions) {
+		return false
+	}
+	for i := range a.Conditions {
+		ac, bc := a.Conditions[i], b.Conditions[i]
+		if ac.Type != bc.Type || ac.Status != bc.Status || ac.Reason != bc.Reason || ac.Message != bc.Message {
+			return false
+		}
+	}
+	return true
+}